@@ -0,0 +1,75 @@
+import os
+import threading
+from concurrent import futures
+import grpc
+from dotenv import load_dotenv
+# ai_pb2 / ai_pb2_grpc は proto/ai.proto から生成する（make gen-python、Docker イメージではビルド時に生成する）
+import ai_pb2
+import ai_pb2_grpc
+from sam import load_sam_model, process_image_bytes, Coordinate, Box
+
+# レスポンスで1つのメッセージに入れる画像のバイト数
+CHUNK_SIZE = 1024 * 1024
+
+load_dotenv()
+
+class ImageEditService(ai_pb2_grpc.ImageEditServiceServicer):
+    def __init__(self, predictor):
+        self.predictor = predictor
+        # SamPredictor は set_image() の結果を保持するため、同時に1つのリクエストだけが使う
+        self.predictor_lock = threading.Lock()
+
+    def Extract(self, request_iterator, context):
+        # 最初のメッセージが抽出範囲、その後は画像の断片
+        prompt = None
+        image = bytearray()
+        for request in request_iterator:
+            kind = request.WhichOneof('payload')
+            if kind == 'prompt':
+                prompt = request.prompt
+            elif kind == 'image_chunk':
+                image.extend(request.image_chunk)
+
+        if prompt is None:
+            context.abort(grpc.StatusCode.INVALID_ARGUMENT, "prompt is required")
+        if not image:
+            context.abort(grpc.StatusCode.INVALID_ARGUMENT, "image is required")
+
+        points = [
+            Coordinate(x=p.x, y=p.y, label=0 if p.label == ai_pb2.POINT_LABEL_NEGATIVE else 1)
+            for p in prompt.points
+        ]
+        box = None
+        if prompt.HasField('box'):
+            b = prompt.box
+            box = Box(x1=b.x1, y1=b.y1, x2=b.x2, y2=b.y2)
+
+        try:
+            with self.predictor_lock:
+                result_bytes, mask_bytes = process_image_bytes(bytes(image), points, self.predictor, box)
+        except Exception as e:
+            print(f"❌ エラー発生: {str(e)}")
+            context.abort(grpc.StatusCode.INTERNAL, str(e))
+
+        for i in range(0, len(result_bytes), CHUNK_SIZE):
+            yield ai_pb2.ExtractResponse(result_chunk=result_bytes[i:i + CHUNK_SIZE])
+        for i in range(0, len(mask_bytes), CHUNK_SIZE):
+            yield ai_pb2.ExtractResponse(mask_chunk=mask_bytes[i:i + CHUNK_SIZE])
+
+def serve():
+    # モデルは起動時に1度だけロードする
+    print("🧠 SAM モデルをロード中...")
+    predictor = load_sam_model()
+    print("✅ モデル準備完了")
+
+    # 画像の受信と送信は並行して行い、推論は predictor_lock で1つずつ実行する
+    server = grpc.server(futures.ThreadPoolExecutor(max_workers=2))
+    ai_pb2_grpc.add_ImageEditServiceServicer_to_server(ImageEditService(predictor), server)
+    port = os.environ.get('PORT', '8080')
+    server.add_insecure_port(f'[::]:{port}')
+    server.start()
+    print(f"🚀 gRPC サーバーを起動しました: {port}")
+    server.wait_for_termination()
+
+if __name__ == '__main__':
+    serve()
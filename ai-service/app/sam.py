@@ -1,5 +1,5 @@
 from dataclasses import dataclass
-from typing import List
+from typing import List, Optional
 import cv2
 import numpy as np
 import torch
@@ -14,6 +14,15 @@ import boto3
 class Coordinate:
     x: float
     y: float
+    # SAM の point_labels と同じ（1: 抽出するホールド、0: 除外する部分）
+    label: int = 1
+
+@dataclass
+class Box:
+    x1: float
+    y1: float
+    x2: float
+    y2: float
 
 def download_model():
     bucket_name = 'sam-models'
@@ -54,10 +63,12 @@ def build_combined_mask_from_clicks(
     image: np.ndarray,
     points: List[Coordinate],
     predictor: SamPredictor,
+    box: Optional[Box] = None,
     min_area: int = 0
 ) -> np.ndarray:
     """
-    クリック位置ごとにpredict()を呼び、マスクを合成する。
+    抽出するクリック位置ごとにpredict()を呼び、マスクを合成する。
+    除外するクリック位置と矩形は毎回一緒に渡す。
     小さすぎるマスクは除外。
 
     Returns:
@@ -65,13 +76,21 @@ def build_combined_mask_from_clicks(
     """
     combined_mask = np.zeros_like(image[:, :, 0], dtype=bool)  # shape: (H, W)
 
-    for p in points:
-        input_point = np.array([[p.x, p.y]])
-        input_label = np.array([1])  # 前景とみなす
+    positives = [p for p in points if p.label != 0]
+    negatives = [p for p in points if p.label == 0]
+    input_box = np.array([box.x1, box.y1, box.x2, box.y2]) if box else None
+
+    # 抽出するクリックがなければ矩形だけで1回予測する
+    prompts = [[p] for p in positives] if positives else [[]]
+    for prompt in prompts:
+        clicks = prompt + negatives
+        input_point = np.array([[p.x, p.y] for p in clicks]) if clicks else None
+        input_label = np.array([1] * len(prompt) + [0] * len(negatives)) if clicks else None
 
         masks, _, _ = predictor.predict(
             point_coords=input_point,
             point_labels=input_label,
+            box=input_box,
             multimask_output=False
         )
 
@@ -125,11 +144,11 @@ def encode_image(image_array: np.ndarray) -> bytes:
 
 
 # メイン処理（バイナリ入出力）
-def process_image_bytes(image_bytes: bytes, points: List[Coordinate], predictor: SamPredictor) -> bytes:
+def process_image_bytes(image_bytes: bytes, points: List[Coordinate], predictor: SamPredictor, box: Optional[Box] = None) -> bytes:
     image = decode_image(image_bytes)
     predictor.set_image(image)
 
-    combined_mask = build_combined_mask_from_clicks(image, points, predictor)
+    combined_mask = build_combined_mask_from_clicks(image, points, predictor, box)
 
     # 合成マスクが空だった場合
     if np.sum(combined_mask) == 0:
@@ -5,7 +5,7 @@ from dotenv import load_dotenv
 from pydantic import BaseModel
 from fastapi import FastAPI, Request, Response, HTTPException
 from fastapi.responses import JSONResponse
-from sam import load_sam_model, process_image_bytes, Coordinate
+from sam import load_sam_model, process_image_bytes, Coordinate, Box
 
 MAX_MESSAGE_LENGTH = 20 * 1024 * 1024  # 20MB に増やすなど
 
@@ -38,10 +38,10 @@ async def process(request: Request):
         zip_data = await request.body()
         
         # Parse zip data to extract image and points
-        image_bytes, points = parse_zip_data(zip_data)
+        image_bytes, points, box = parse_zip_data(zip_data)
         
         # Process image using SAM
-        result_bytes, mask_bytes = process_image_bytes(image_bytes, points, predictor)
+        result_bytes, mask_bytes = process_image_bytes(image_bytes, points, predictor, box)
         
         # Create zip response
         response_zip_data = create_zip_response(result_bytes, mask_bytes)
@@ -58,11 +58,12 @@ async def process(request: Request):
 
 def parse_zip_data(zip_data: bytes) -> tuple:
     """
-    Parse zip data to extract image bytes and points.
+    Parse zip data to extract image bytes, points and optional box.
     """
     zip_buffer = io.BytesIO(zip_data)
     image_bytes = None
     points = None
+    box = None
     
     with zipfile.ZipFile(zip_buffer, 'r') as zip_file:
         # Read image binary
@@ -76,11 +77,14 @@ def parse_zip_data(zip_data: bytes) -> tuple:
         if 'points.json' in zip_file.namelist():
             with zip_file.open('points.json') as points_file:
                 points_data = json.loads(points_file.read().decode('utf-8'))
-                points = [Coordinate(x=p['x'], y=p['y']) for p in points_data['points']]
+                points = [Coordinate(x=p['x'], y=p['y'], label=p.get('label', 1)) for p in points_data['points'] or []]
+                if points_data.get('box'):
+                    b = points_data['box']
+                    box = Box(x1=b['x1'], y1=b['y1'], x2=b['x2'], y2=b['y2'])
         else:
             raise ValueError("points.json not found in zip file")
     
-    return image_bytes, points
+    return image_bytes, points, box
 
 def create_zip_response(result_bytes: bytes, mask_bytes: bytes) -> bytes:
     """
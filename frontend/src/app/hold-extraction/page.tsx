@@ -4,7 +4,17 @@ import React, { useRef, useState } from "react";
 import { useResultStore } from "@/stores/resultStore";
 import { useRouter } from "next/navigation";
 
-type Point = { x: number; y: number };
+// positive: 抽出するホールド、negative: 除外する部分（隣のホールドなど）
+type Point = { x: number; y: number; label: "positive" | "negative" };
+
+// 背景に適用する効果（空ならAIの加工結果をそのまま使う）
+const effects = [
+  { value: "", label: "標準" },
+  { value: "grayscale", label: "背景をモノクロにする" },
+  { value: "blur", label: "背景をぼかす" },
+  { value: "dim", label: "背景を暗くする" },
+  { value: "outline", label: "ホールドを縁取る" },
+];
 
 export default function TopPage() {
   const router = useRouter();
@@ -13,6 +23,9 @@ export default function TopPage() {
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
   const [points, setPoints] = useState<Point[]>([]);
+  const [keepCaptureTime, setKeepCaptureTime] = useState(false);
+  const [effect, setEffect] = useState("");
+  const [excluding, setExcluding] = useState(false);
 
   const handleClick = (e: React.MouseEvent<HTMLImageElement>) => {
     const rect = e.currentTarget.getBoundingClientRect();
@@ -28,7 +41,10 @@ export default function TopPage() {
     if (index !== -1) {
       setPoints((prev) => prev.filter((_, i) => i !== index));
     } else {
-      setPoints((prev) => [...prev, { x, y }]);
+      setPoints((prev) => [
+        ...prev,
+        { x, y, label: excluding ? "negative" : "positive" },
+      ]);
     }
   };
 
@@ -49,18 +65,27 @@ export default function TopPage() {
       setError("画像を選択してください");
       return;
     }
+    if (!points.some((p) => p.label === "positive")) {
+      setError("抽出するホールドを1つ以上選択してください");
+      return;
+    }
 
     setLoading(true);
     setError(null);
+    // 表示サイズに対する割合で送る（元の画像の解像度はサーバーで扱う）
     const rect = imageRef.current;
     const normalizedPoints = points.map((p) => ({
-      x: p.x * ((rect?.naturalWidth || 1) / (rect?.width || 1)),
-      y: p.y * ((rect?.naturalHeight || 1) / (rect?.height || 1)),
+      x: Math.min(Math.max(p.x / (rect?.width || 1), 0), 1),
+      y: Math.min(Math.max(p.y / (rect?.height || 1), 0), 1),
+      label: p.label,
     }));
 
     const formData = new FormData();
     formData.append("image", image);
     formData.append("points", JSON.stringify(normalizedPoints));
+    formData.append("normalized", "true");
+    formData.append("keepCaptureTime", String(keepCaptureTime));
+    formData.append("effect", effect);
 
     try {
       const res = await fetch(
@@ -107,7 +132,7 @@ export default function TopPage() {
                 画像をここにアップロード またはクリックして選択
               </span>
               <span className="text-xs text-orange-500">
-                (JPEG / PNG / HEIC など対応)
+                (JPEG / PNG / WebP に対応)
               </span>
             </label>
             <input
@@ -137,12 +162,20 @@ export default function TopPage() {
                     cx={point.x}
                     cy={point.y}
                     r={4}
-                    fill="red"
+                    fill={point.label === "negative" ? "blue" : "red"}
                   />
                 ))}
               </svg>
             </div>
-            <div className="text-right">
+            <div className="flex items-center justify-between">
+              <label className="flex items-center gap-2 text-sm text-gray-700">
+                <input
+                  type="checkbox"
+                  checked={excluding}
+                  onChange={(e) => setExcluding(e.target.checked)}
+                />
+                除外する部分を選ぶ（青い点）
+              </label>
               <button
                 className="text-sm text-orange-700 hover:text-orange-900 border border-orange-700 rounded px-3 py-1 hover:shadow-lg"
                 onClick={() => {
@@ -155,6 +188,30 @@ export default function TopPage() {
           </div>
         )}
 
+        <label className="flex items-center gap-2 text-sm text-gray-700">
+          仕上がり
+          <select
+            value={effect}
+            onChange={(e) => setEffect(e.target.value)}
+            className="border border-orange-300 rounded px-2 py-1"
+          >
+            {effects.map((e) => (
+              <option key={e.value} value={e.value}>
+                {e.label}
+              </option>
+            ))}
+          </select>
+        </label>
+
+        <label className="flex items-center gap-2 text-sm text-gray-700">
+          <input
+            type="checkbox"
+            checked={keepCaptureTime}
+            onChange={(e) => setKeepCaptureTime(e.target.checked)}
+          />
+          撮影日時を画像に残す（位置情報や端末情報は常に削除されます）
+        </label>
+
         {error && <p className="text-red-600 text-sm">⚠ {error}</p>}
 
         <button
@@ -171,7 +228,7 @@ export default function TopPage() {
               1. 課題の写真を選んでください
             </p>
             <p className="text-sm sm:text-base text-gray-700 mt-2">
-              壁全体が写っているJPEG / PNG / HEIC
+              壁全体が写っているJPEG / PNG / WebP
               画像をアップロードしてください。
             </p>
           </li>
@@ -6,6 +6,7 @@ import { useState } from "react";
 import { Label } from "@/components/ui/label";
 import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select";
 import { Input } from "@/components/ui/input";
+import { Textarea } from "@/components/ui/textarea";
 import { Button } from "../ui/button";
 
 
@@ -16,6 +17,8 @@ export default function ContentsInputForm() {
   const [style, setStyle] = useState("");
   const [tryCount, setTryCount] = useState<number| undefined>();
   const [isGenerate, setIsGenerate] = useState(false);
+  const [impression, setImpression] = useState("");
+  const [tone, setTone] = useState("casual");
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
 
@@ -33,13 +36,13 @@ export default function ContentsInputForm() {
 
     setLoading(true);
     setError(null);
+    const contentRequest = { grade, gym, style, tryCount, impression, tone };
+    // 結果画面で投稿文の候補を追加するときに同じ内容を使う
+    useResultStore.getState().setContentRequest(contentRequest);
     const body = JSON.stringify({
       sessionId,
-      grade,
-      gym,
-      style,
-      tryCount,
-      isGenerate
+      ...contentRequest,
+      isGenerate,
     })
 
     try {
@@ -125,6 +128,34 @@ export default function ContentsInputForm() {
             SNSの投稿文を自動で生成する
           </Label>
         </div>
+        {isGenerate && (
+          <div className="space-y-4">
+            <div>
+              <Label htmlFor="impression" className="block text-sm font-medium">感想</Label>
+              <Textarea
+                id="impression"
+                value={impression}
+                maxLength={200}
+                onChange={(e) => setImpression(e.target.value)}
+                placeholder="例: 最後のランジが決まって嬉しかった！"
+              />
+            </div>
+            <div className='space-y-2'>
+              <Label htmlFor="tone" className="block text-sm font-medium">口調</Label>
+              <Select onValueChange={setTone} value={tone}>
+                <SelectTrigger id="tone" className="w-full">
+                  <SelectValue />
+                </SelectTrigger>
+                <SelectContent>
+                  <SelectItem value="casual">カジュアル</SelectItem>
+                  <SelectItem value="technical">テクニカル</SelectItem>
+                  <SelectItem value="humble">控えめ</SelectItem>
+                  <SelectItem value="hype">ハイテンション</SelectItem>
+                </SelectContent>
+              </Select>
+            </div>
+          </div>
+        )}
 
       {error && <p className="text-red-600 text-sm">⚠ {error}</p>}
 
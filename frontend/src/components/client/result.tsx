@@ -6,11 +6,40 @@ import Link from "next/link";
 import { useSearchParams } from "next/navigation";
 import { useRouter } from "next/navigation";
 import { useEffect, useRef, useState } from "react";
+import { useResultStore } from "@/stores/resultStore";
+
+// サイズ別の画像の表示名
+const renditionLabels: Record<string, string> = {
+  square: "正方形 (1080×1080)",
+  portrait: "縦長 (1080×1350)",
+  story: "ストーリー (1080×1920)",
+};
+
+// 作り直すときに選べる効果
+const effects = [
+  { value: "grayscale", label: "背景をモノクロにする" },
+  { value: "blur", label: "背景をぼかす" },
+  { value: "dim", label: "背景を暗くする" },
+  { value: "outline", label: "ホールドを縁取る" },
+];
+
+type Candidate = { contents: string };
+
+// content / done イベントの候補一覧を投稿文の配列にする（candidates がなければ contents だけ）
+const candidateContents = (data: {
+  contents: string;
+  candidates?: Candidate[];
+}) => data.candidates?.map((c) => c.contents) ?? [data.contents];
 
 export default function Result() {
   const router = useRouter();
   const [imageData, setImageData] = useState<string | null>(null);
-  const [content, setContent] = useState<string | null>(null);
+  const [renditions, setRenditions] = useState<Record<string, string>>({});
+  const [candidates, setCandidates] = useState<string[] | null>(null);
+  const [selected, setSelected] = useState(0);
+  const [draft, setDraft] = useState("");
+  const [rendering, setRendering] = useState(false);
+  const [regenerating, setRegenerating] = useState(false);
   const searchParams = useSearchParams();
   const sessionId = searchParams.get("session");
 
@@ -20,22 +49,47 @@ export default function Result() {
       process.env.NEXT_PUBLIC_API_URL + `/result?session=${sessionId}`
     );
 
-    es.onmessage = (event) => {
+    const parse = (event: MessageEvent) => {
       try {
-        const data = JSON.parse(event.data);
-
-        // 正常データ受信時
-        setImageData(data.image);
-        setContent(data.contents);
-        es.close();
+        return JSON.parse(event.data);
       } catch (err) {
         console.log(err);
         alert("レスポンスの解析に失敗しました");
         es.close();
         router.push("/");
+        return null;
       }
     };
 
+    // 抽出画像は投稿文の生成を待たずに表示する
+    es.addEventListener("image", (event) => {
+      const data = parse(event);
+      if (!data) return;
+      setImageData(data.image);
+      setRenditions(data.renditions ?? {});
+    });
+
+    // 生成途中の投稿文（先頭の候補のみ表示する）
+    es.addEventListener("content-delta", (event) => {
+      const data = parse(event);
+      if (!data || data.candidate !== 0) return;
+      setDraft((prev) => (data.reset ? data.delta : prev + data.delta));
+    });
+
+    es.addEventListener("content", (event) => {
+      const data = parse(event);
+      if (data) setCandidates(candidateContents(data));
+    });
+
+    es.addEventListener("done", (event) => {
+      const data = parse(event);
+      if (!data) return;
+      setImageData(data.image);
+      setRenditions(data.renditions ?? {});
+      setCandidates(candidateContents(data));
+      es.close();
+    });
+
     es.addEventListener("timeout", (event) => {
       const data = JSON.parse(event.data);
       console.log("⏱ タイムアウトイベント", data.error); // "timeout"
@@ -45,10 +99,23 @@ export default function Result() {
     });
 
     es.onerror = (err) => {
+      // サーバーから送られた error イベント（処理失敗）
+      if (err instanceof MessageEvent) {
+        const data = JSON.parse(err.data);
+        console.log("処理失敗:", data.stage, data.error);
+        alert("画像処理に失敗しました。もう一度お試しください。");
+        es.close();
+        router.push("/");
+        return;
+      }
+      // 接続が切れてもブラウザが Last-Event-ID 付きで再接続する
+      if (es.readyState === EventSource.CONNECTING) {
+        console.log("SSE再接続中:", err);
+        return;
+      }
       console.log("SSE接続エラー:", err);
       alert("サーバーとの接続に失敗しました。再接続を試みてください。");
       es.close();
-      // 再接続のロジックをここに追加
       router.push("/"); // トップページに戻る
     };
 
@@ -83,11 +150,75 @@ export default function Result() {
     }, "image/png");
   };
 
-  if (!imageData || !content) return <LoadingScreen />;
+  // 抽出をやり直さずに、別の効果で画像を作り直す
+  const handleRender = async (effect: string) => {
+    if (!sessionId || !effect) return;
+    setRendering(true);
+    try {
+      const res = await fetch(
+        process.env.NEXT_PUBLIC_API_URL + `/images/${sessionId}/render`,
+        {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ effect }),
+        }
+      );
+      if (!res.ok) throw new Error(`status ${res.status}`);
+      const data = await res.json();
+      setImageData(data.image);
+      setRenditions(data.renditions ?? {});
+    } catch (err) {
+      console.log(err);
+      alert("画像の作り直しに失敗しました");
+    } finally {
+      setRendering(false);
+    }
+  };
+
+  // 同じ入力内容で投稿文の候補を追加する
+  const handleRegenerate = async () => {
+    const contentRequest = useResultStore.getState().contentRequest;
+    if (!sessionId || !contentRequest) return;
+    setRegenerating(true);
+    try {
+      const res = await fetch(
+        process.env.NEXT_PUBLIC_API_URL + "/contents/regenerate",
+        {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({
+            ...contentRequest,
+            sessionId,
+            isGenerate: true,
+            candidates: 1,
+          }),
+        }
+      );
+      if (res.status === 409) {
+        alert("これ以上候補を追加できません");
+        return;
+      }
+      if (!res.ok) throw new Error(`status ${res.status}`);
+      const data = await res.json();
+      const added = (data.candidates as Candidate[]).map((c) => c.contents);
+      // 追加した候補を選択する
+      setSelected(candidates?.length ?? 0);
+      setCandidates((prev) => [...(prev ?? []), ...added]);
+    } catch (err) {
+      console.log(err);
+      alert("投稿文の追加に失敗しました");
+    } finally {
+      setRegenerating(false);
+    }
+  };
+
+  const content = candidates?.[selected] ?? candidates?.[0] ?? null;
+
+  if (!imageData) return <LoadingScreen />;
 
   return (
     <main className="max-w-xl mx-auto p-4 sm:p-6 space-y-4 sm:space-y-6">
-      {imageData && content && (
+      {imageData && (
         <>
           <h1 className="text-xl sm:text-2xl font-bold text-center">処理結果</h1>
           <Image
@@ -101,6 +232,25 @@ export default function Result() {
             className="w-full max-w-full rounded-lg shadow"
           />
 
+          <label className="flex items-center gap-2 text-sm text-gray-700">
+            仕上がりを変える
+            <select
+              defaultValue=""
+              disabled={rendering}
+              onChange={(e) => handleRender(e.target.value)}
+              className="border border-orange-300 rounded px-2 py-1"
+            >
+              <option value="" disabled>
+                選択してください
+              </option>
+              {effects.map((e) => (
+                <option key={e.value} value={e.value}>
+                  {e.label}
+                </option>
+              ))}
+            </select>
+          </label>
+
           <button
             onClick={handleDownload}
             className="w-full sm:w-auto block text-center bg-orange-500 text-white px-6 py-3 rounded-lg hover:bg-orange-600 font-medium"
@@ -108,7 +258,48 @@ export default function Result() {
             画像をダウンロード
           </button>
 
+          {Object.keys(renditionLabels).some((name) => renditions[name]) && (
+            <div className="flex flex-wrap gap-2">
+              {Object.entries(renditionLabels).map(
+                ([name, label]) =>
+                  renditions[name] && (
+                    <a
+                      key={name}
+                      href={renditions[name]}
+                      target="_blank"
+                      rel="noopener noreferrer"
+                      className="text-sm text-orange-700 hover:text-orange-900 border border-orange-700 rounded-lg px-3 py-1 hover:shadow-lg"
+                    >
+                      {label}
+                    </a>
+                  )
+              )}
+            </div>
+          )}
+
+          {content === null ? (
+            <p className="text-xs sm:text-sm whitespace-pre-line text-gray-600 p-3 sm:p-4">
+              {draft || "投稿文を生成中..."}
+            </p>
+          ) : (
           <div className="p-4 rounded">
+            {candidates && candidates.length > 1 && (
+              <div className="flex flex-wrap gap-2 mb-3">
+                {candidates.map((_, i) => (
+                  <button
+                    key={i}
+                    onClick={() => setSelected(i)}
+                    className={`text-sm border rounded-lg px-3 py-1 ${
+                      i === selected
+                        ? "bg-orange-500 text-white border-orange-500"
+                        : "text-orange-700 border-orange-700 hover:shadow-lg"
+                    }`}
+                  >
+                    候補 {i + 1}
+                  </button>
+                ))}
+              </div>
+            )}
             <p className="text-xs sm:text-sm whitespace-pre-line bg-orange-50 border-4 border-orange-300 p-3 sm:p-4 rounded-lg">
               {content}
             </p>
@@ -134,7 +325,17 @@ export default function Result() {
             >
               投稿文をコピー
             </button>
+            {useResultStore.getState().contentRequest && (
+              <button
+                onClick={handleRegenerate}
+                disabled={regenerating}
+                className="mt-3 sm:ml-2 w-full sm:w-auto text-sm text-orange-700 hover:text-orange-900 border border-orange-700 rounded-lg px-4 py-2 hover:shadow-lg font-medium disabled:opacity-50"
+              >
+                {regenerating ? "生成中..." : "別の投稿文を作る"}
+              </button>
+            )}
           </div>
+          )}
         </>
       )}
 
@@ -3,10 +3,22 @@
 import { create } from "zustand";
 import { persist } from "zustand/middleware";
 
+// 投稿文を追加で生成するときに使う、入力フォームの内容
+export type ContentRequest = {
+  grade: string;
+  gym: string;
+  style: string;
+  tryCount: number;
+  impression: string;
+  tone: string;
+};
+
 type ResultState = {
   imageUrl: string | null;
   session: string | null;
+  contentRequest: ContentRequest | null;
   setResult: (imageUrl: string, session: string) => void;
+  setContentRequest: (contentRequest: ContentRequest) => void;
   clear: () => void;
 };
 
@@ -15,8 +27,10 @@ export const useResultStore = create<ResultState>()(
     (set) => ({
       imageUrl: null,
       session: null,
+      contentRequest: null,
       setResult: (imageUrl, session) => set({ imageUrl, session }),
-      clear: () => set({ imageUrl: null, session: null }),
+      setContentRequest: (contentRequest) => set({ contentRequest }),
+      clear: () => set({ imageUrl: null, session: null, contentRequest: null }),
     }),
     {
       name: "result-storage", // localStorageに保存されるキー名
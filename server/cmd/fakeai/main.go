@@ -0,0 +1,38 @@
+// fakeai はAIサービスの代わりに、色の近い画素を塗りつぶしたマスクを返すローカル用のサーバー。
+//
+//	go run ./cmd/fakeai -addr :8090
+//	go run ./cmd/fakeai -addr :8090 -grpc
+//
+// API サーバーは AI_SERVER_URL=http://localhost:8090 と AI_SERVER_AUTH=none で接続する
+package main
+
+import (
+	"climbinsight/server/internal/aipb"
+	"climbinsight/server/internal/fakeai"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	useGRPC := flag.Bool("grpc", false, "serve gRPC (proto/ai.proto) instead of zip over HTTP")
+	flag.Parse()
+
+	if *useGRPC {
+		lis, err := net.Listen("tcp", *addr)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		server := grpc.NewServer()
+		aipb.RegisterImageEditServiceServer(server, fakeai.GRPCServer{})
+		log.Printf("🚀 fake AI server (gRPC) listening on %s\n", *addr)
+		log.Fatal(server.Serve(lis))
+	}
+
+	log.Printf("🚀 fake AI server (HTTP) listening on %s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, fakeai.NewHandler()))
+}
@@ -0,0 +1,140 @@
+package compositing
+
+import (
+	"climbinsight/server/internal/imaging"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Effect はホールド以外（背景）に適用する効果
+type Effect string
+
+const (
+	// EffectNone は効果を適用せず、AIサービスの加工結果をそのまま使う
+	EffectNone      Effect = ""
+	EffectGrayscale Effect = "grayscale"
+	EffectBlur      Effect = "blur"
+	EffectDim       Effect = "dim"
+	EffectOutline   Effect = "outline"
+)
+
+var supportedEffects = map[Effect]bool{
+	EffectNone:      true,
+	EffectGrayscale: true,
+	EffectBlur:      true,
+	EffectDim:       true,
+	EffectOutline:   true,
+}
+
+func (e Effect) IsSupported() bool {
+	return supportedEffects[e]
+}
+
+// DefaultOutlineColor は輪郭の色を指定しなかった場合の色
+var DefaultOutlineColor = color.NRGBA{R: 0xFF, G: 0x6A, B: 0x00, A: 0xFF}
+
+// Options は合成の設定
+type Options struct {
+	Effect Effect
+	// Color は outline で描く輪郭の色
+	Color color.NRGBA
+}
+
+// NewOptions は効果名と "#rrggbb" 形式の色から設定を作る。色が空なら DefaultOutlineColor を使う
+func NewOptions(effect string, hexColor string) (Options, error) {
+	opts := Options{Effect: Effect(effect), Color: DefaultOutlineColor}
+	if !opts.Effect.IsSupported() {
+		return Options{}, fmt.Errorf("unsupported effect: %q", effect)
+	}
+	if hexColor != "" {
+		c, err := parseHexColor(hexColor)
+		if err != nil {
+			return Options{}, err
+		}
+		opts.Color = c
+	}
+	return opts, nil
+}
+
+func parseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
+}
+
+// Composite はマスクの白い部分（ホールド）を元の画像のまま残し、それ以外に効果を適用した画像を返す。
+// マスクと元の画像の解像度が異なる場合は、マスクを元の画像の解像度に合わせて合成する
+func Composite(original image.Image, mask image.Image, opts Options) (*image.NRGBA, error) {
+	if opts.Effect == EffectNone {
+		return nil, errors.New("no effect specified")
+	}
+	if !opts.Effect.IsSupported() {
+		return nil, fmt.Errorf("unsupported effect: %q", opts.Effect)
+	}
+
+	// 縮小してAIサービスに送った場合もマスクは縮小後の解像度で返るため、元の画像を縮めずにマスクを拡大する
+	src := imaging.ToNRGBA(original)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	alpha := imaging.ResizeMask(mask, width, height).Pix
+
+	switch opts.Effect {
+	case EffectOutline:
+		return outline(src, alpha, opts.Color), nil
+	case EffectGrayscale:
+		return blend(src, grayscale(src), alpha), nil
+	case EffectBlur:
+		return blend(src, blur(src, blurRadius(width, height)), alpha), nil
+	default:
+		return blend(src, dim(src), alpha), nil
+	}
+}
+
+// blend はマスクの値を不透明度として、前景（元の画像）を背景に重ねる
+func blend(fg, bg *image.NRGBA, alpha []uint8) *image.NRGBA {
+	out := image.NewNRGBA(fg.Rect)
+	w, h := fg.Rect.Dx(), fg.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := uint32(alpha[y*w+x])
+			i := y*fg.Stride + x*4
+			for c := 0; c < 4; c++ {
+				out.Pix[i+c] = uint8((uint32(fg.Pix[i+c])*a + uint32(bg.Pix[i+c])*(255-a) + 127) / 255)
+			}
+		}
+	}
+	return out
+}
+
+func grayscale(src *image.NRGBA) *image.NRGBA {
+	out := image.NewNRGBA(src.Rect)
+	for i := 0; i+3 < len(src.Pix); i += 4 {
+		r, g, b := uint32(src.Pix[i]), uint32(src.Pix[i+1]), uint32(src.Pix[i+2])
+		y := uint8((299*r + 587*g + 114*b + 500) / 1000)
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = y, y, y, src.Pix[i+3]
+	}
+	return out
+}
+
+// dimFactor は dim で背景に掛ける明るさの倍率（‰）
+const dimFactor = 350
+
+func dim(src *image.NRGBA) *image.NRGBA {
+	out := image.NewNRGBA(src.Rect)
+	for i := 0; i+3 < len(src.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			out.Pix[i+c] = uint8(uint32(src.Pix[i+c]) * dimFactor / 1000)
+		}
+		out.Pix[i+3] = src.Pix[i+3]
+	}
+	return out
+}
@@ -0,0 +1,147 @@
+package compositing
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// テスト用の元の画像は 64x32 の市松模様で、マスクは半分の 32x16。
+// マスクの左側（元の画像の x < 16）がホールド
+const (
+	testWidth  = 64
+	testHeight = 32
+	holdEdge   = 16
+)
+
+var (
+	checkerDark  = color.NRGBA{R: 40, G: 80, B: 120, A: 255}
+	checkerLight = color.NRGBA{R: 220, G: 200, B: 180, A: 255}
+)
+
+func checkerImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, testWidth, testHeight))
+	for y := 0; y < testHeight; y++ {
+		for x := 0; x < testWidth; x++ {
+			c := checkerDark
+			if (x+y)%2 == 1 {
+				c = checkerLight
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func holdMask() *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, testWidth/2, testHeight/2))
+	for y := 0; y < testHeight/2; y++ {
+		for x := 0; x < holdEdge/2; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	return mask
+}
+
+func TestComposite(t *testing.T) {
+	original := checkerImage()
+	// ホールドの内側と、ホールドから離れた背景の画素
+	holdPoints := []image.Point{{2, 2}, {5, 16}, {holdEdge - 4, testHeight - 3}}
+	backgroundPoints := []image.Point{{40, 16}, {41, 16}, {50, 8}}
+
+	tests := []struct {
+		effect Effect
+		// background は背景の画素の期待値を確かめる
+		background func(t *testing.T, p image.Point, got color.NRGBA)
+	}{
+		{EffectGrayscale, func(t *testing.T, p image.Point, got color.NRGBA) {
+			src := original.NRGBAAt(p.X, p.Y)
+			y := uint8((299*uint32(src.R) + 587*uint32(src.G) + 114*uint32(src.B) + 500) / 1000)
+			if want := (color.NRGBA{R: y, G: y, B: y, A: 255}); got != want {
+				t.Errorf("%v = %v, want %v", p, got, want)
+			}
+		}},
+		{EffectBlur, func(t *testing.T, p image.Point, got color.NRGBA) {
+			// 市松模様がぼけて2色の中間に近づく
+			mid := func(a, b uint8) uint8 { return uint8((int(a) + int(b)) / 2) }
+			want := color.NRGBA{R: mid(checkerDark.R, checkerLight.R), G: mid(checkerDark.G, checkerLight.G), B: mid(checkerDark.B, checkerLight.B), A: 255}
+			if absDiff(got.R, want.R) > 8 || absDiff(got.G, want.G) > 8 || absDiff(got.B, want.B) > 8 || got.A != 255 {
+				t.Errorf("%v = %v, want about %v", p, got, want)
+			}
+		}},
+		{EffectDim, func(t *testing.T, p image.Point, got color.NRGBA) {
+			src := original.NRGBAAt(p.X, p.Y)
+			want := color.NRGBA{R: uint8(uint32(src.R) * dimFactor / 1000), G: uint8(uint32(src.G) * dimFactor / 1000), B: uint8(uint32(src.B) * dimFactor / 1000), A: 255}
+			if got != want {
+				t.Errorf("%v = %v, want %v", p, got, want)
+			}
+		}},
+		{EffectOutline, func(t *testing.T, p image.Point, got color.NRGBA) {
+			// 輪郭から離れた背景はそのまま残る
+			if want := original.NRGBAAt(p.X, p.Y); got != want {
+				t.Errorf("%v = %v, want %v", p, got, want)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.effect), func(t *testing.T) {
+			out, err := Composite(original, holdMask(), Options{Effect: tt.effect, Color: DefaultOutlineColor})
+			if err != nil {
+				t.Fatalf("Composite: %v", err)
+			}
+			// マスクの解像度が低くても、元の画像の解像度で出力する
+			if out.Rect != original.Rect {
+				t.Fatalf("bounds = %v, want %v", out.Rect, original.Rect)
+			}
+			for _, p := range holdPoints {
+				if got, want := out.NRGBAAt(p.X, p.Y), original.NRGBAAt(p.X, p.Y); got != want {
+					t.Errorf("hold %v = %v, want %v", p, got, want)
+				}
+			}
+			for _, p := range backgroundPoints {
+				tt.background(t, p, out.NRGBAAt(p.X, p.Y))
+			}
+		})
+	}
+}
+
+func TestCompositeOutline(t *testing.T) {
+	original := checkerImage()
+	out, err := Composite(original, holdMask(), Options{Effect: EffectOutline, Color: DefaultOutlineColor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ホールドの右端のすぐ外側にだけ輪郭が描かれる
+	y := testHeight / 2
+	var drawn []int
+	for x := 0; x < testWidth; x++ {
+		if out.NRGBAAt(x, y) != original.NRGBAAt(x, y) {
+			if got := out.NRGBAAt(x, y); got != DefaultOutlineColor {
+				t.Errorf("(%d, %d) = %v, want outline color", x, y, got)
+			}
+			drawn = append(drawn, x)
+		}
+	}
+	if len(drawn) == 0 {
+		t.Fatal("outline was not drawn")
+	}
+	if drawn[0] < holdEdge-2 || drawn[len(drawn)-1] > holdEdge+4 {
+		t.Errorf("outline drawn at x = %v, want near %d", drawn, holdEdge)
+	}
+}
+
+func TestCompositeRejectsNone(t *testing.T) {
+	if _, err := Composite(checkerImage(), holdMask(), Options{}); err == nil {
+		t.Error("Composite succeeded without an effect")
+	}
+	if _, err := Composite(checkerImage(), holdMask(), Options{Effect: "sepia"}); err == nil {
+		t.Error("Composite succeeded with an unsupported effect")
+	}
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,129 @@
+package compositing
+
+import (
+	"image"
+	"image/color"
+)
+
+// blurRadius は画像の大きさに応じたぼかしの半径を返す
+func blurRadius(width, height int) int {
+	return max(2, max(width, height)/150)
+}
+
+// blur はボックスブラーを 3 回かけてガウスぼかしに近づける
+func blur(src *image.NRGBA, radius int) *image.NRGBA {
+	out := image.NewNRGBA(src.Rect)
+	copy(out.Pix, src.Pix)
+	tmp := image.NewNRGBA(src.Rect)
+	for i := 0; i < 3; i++ {
+		boxBlur(out, tmp, radius, true)
+		boxBlur(tmp, out, radius, false)
+	}
+	return out
+}
+
+// boxBlur は横方向（horizontal が false なら縦方向）に移動平均をとって dst に書き込む。
+// 端の画素は外側に延長して扱う
+func boxBlur(src, dst *image.NRGBA, radius int, horizontal bool) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	lines, length := h, w
+	if !horizontal {
+		lines, length = w, h
+	}
+	offset := func(line, pos int) int {
+		pos = min(max(pos, 0), length-1)
+		if horizontal {
+			return line*src.Stride + pos*4
+		}
+		return pos*src.Stride + line*4
+	}
+
+	size := uint32(2*radius + 1)
+	for line := 0; line < lines; line++ {
+		var sum [4]uint32
+		for pos := -radius; pos <= radius; pos++ {
+			i := offset(line, pos)
+			for c := 0; c < 4; c++ {
+				sum[c] += uint32(src.Pix[i+c])
+			}
+		}
+		for pos := 0; pos < length; pos++ {
+			o := offset(line, pos)
+			for c := 0; c < 4; c++ {
+				dst.Pix[o+c] = uint8((sum[c] + size/2) / size)
+			}
+			in, out := offset(line, pos+radius+1), offset(line, pos-radius)
+			for c := 0; c < 4; c++ {
+				sum[c] += uint32(src.Pix[in+c])
+				sum[c] -= uint32(src.Pix[out+c])
+			}
+		}
+	}
+}
+
+// maskThreshold 以上のマスクの値をホールドとして扱う
+const maskThreshold = 128
+
+// outline はホールドの周りに色付きの輪郭を描く。ホールドと背景はそのまま残す
+func outline(src *image.NRGBA, alpha []uint8, c color.NRGBA) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	inside := make([]bool, len(alpha))
+	for i, a := range alpha {
+		inside[i] = a >= maskThreshold
+	}
+	expanded := dilate(inside, w, h, max(2, max(w, h)/300))
+
+	out := image.NewNRGBA(src.Rect)
+	copy(out.Pix, src.Pix)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !expanded[y*w+x] || inside[y*w+x] {
+				continue
+			}
+			i := y*out.Stride + x*4
+			out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+	}
+	return out
+}
+
+// dilate はマスクを radius 画素だけ膨張させる。横方向と縦方向に分けて最大値をとる
+func dilate(mask []bool, w, h, radius int) []bool {
+	horizontal := make([]bool, len(mask))
+	for y := 0; y < h; y++ {
+		last := -radius - 1
+		// 左から走査して直近の内側の画素を覚え、右側は先読みで判定する
+		for x := 0; x < w; x++ {
+			if mask[y*w+x] {
+				last = x
+			}
+			horizontal[y*w+x] = x-last <= radius
+		}
+		next := w + radius + 1
+		for x := w - 1; x >= 0; x-- {
+			if mask[y*w+x] {
+				next = x
+			}
+			horizontal[y*w+x] = horizontal[y*w+x] || next-x <= radius
+		}
+	}
+
+	out := make([]bool, len(mask))
+	for x := 0; x < w; x++ {
+		last := -radius - 1
+		for y := 0; y < h; y++ {
+			if horizontal[y*w+x] {
+				last = y
+			}
+			out[y*w+x] = y-last <= radius
+		}
+		next := h + radius + 1
+		for y := h - 1; y >= 0; y-- {
+			if horizontal[y*w+x] {
+				next = y
+			}
+			out[y*w+x] = out[y*w+x] || next-y <= radius
+		}
+	}
+	return out
+}
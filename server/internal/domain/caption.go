@@ -0,0 +1,34 @@
+package domain
+
+import "strings"
+
+// Caption は投稿文の本文とハッシュタグ
+type Caption struct {
+	Body     string   `json:"body"`
+	Hashtags []string `json:"hashtags"`
+}
+
+// NewCaption は言語の必須ハッシュタグを先頭に加え、ハッシュタグを正規化・重複排除した投稿文を返す
+func NewCaption(lang Language, body string, hashtags []string) Caption {
+	tags := make([]string, 0, len(hashtags)+2)
+	seen := make(map[string]bool)
+	for _, t := range append(lang.RequiredHashtags(), hashtags...) {
+		tag := Hashtag(t)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+	return Caption{Body: strings.TrimSpace(body), Hashtags: tags}
+}
+
+// String は本文とハッシュタグを投稿できる形の1つの文字列にする
+func (c Caption) String() string {
+	tags := strings.Join(c.Hashtags, " ")
+	if c.Body == "" {
+		return tags
+	}
+	return c.Body + "\n\n" + tags
+}
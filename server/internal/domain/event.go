@@ -0,0 +1,27 @@
+package domain
+
+// EventType は /result で配信するイベントの種類
+type EventType string
+
+const (
+	EventProgress EventType = "progress"
+	EventImage    EventType = "image"
+	EventContent  EventType = "content"
+	// EventContentDelta は生成途中の投稿文の差分。投稿文の確定後に content イベントが届く
+	EventContentDelta EventType = "content-delta"
+	EventError        EventType = "error"
+	EventDone         EventType = "done"
+)
+
+// Event はセッションに記録されるイベント。ID はセッション内で 1 から始まる連番
+type Event struct {
+	ID   int64
+	Type EventType
+	// Data はJSONエンコード済みのペイロード
+	Data string
+}
+
+// IsTerminal はこのイベント以降に新しいイベントが発生しないかどうかを返す
+func (e Event) IsTerminal() bool {
+	return e.Type == EventDone || e.Type == EventError
+}
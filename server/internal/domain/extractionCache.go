@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// ExtractionCacheEntry は画像ストレージに保存した抽出結果（加工済み画像とマスク）のオブジェクトキー
+type ExtractionCacheEntry struct {
+	// Key は画像と座標から作ったキャッシュのキー
+	Key       string
+	ResultKey string
+	MaskKey   string
+}
+
+// ExtractionCacheStats は抽出結果のキャッシュを引いた回数
+type ExtractionCacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// IExtractionCacheIndex は抽出結果のキャッシュのキーから、画像ストレージに保存した結果を引く索引。
+// 索引から外した結果は、呼び出し側が画像ストレージから削除する
+type IExtractionCacheIndex interface {
+	// Get はキーに対応する結果を返す。ない場合や期限が切れた場合は nil を返す
+	Get(key string) (*ExtractionCacheEntry, error)
+	// Put は結果を登録する。同じキーの結果があれば置き換え、置き換えた結果は元の期限が切れたら TakeExpired で返す
+	Put(entry ExtractionCacheEntry) error
+	// RecordLookup はキャッシュを引いた結果（ヒットしたかどうか）を記録する
+	RecordLookup(hit bool) error
+	Stats() (ExtractionCacheStats, error)
+	// TakeExpired は now までに期限が切れた結果を最大 limit 件索引から外して返す
+	TakeExpired(now time.Time, limit int) ([]ExtractionCacheEntry, error)
+	// Purge はすべての結果を索引から外して返す
+	Purge() ([]ExtractionCacheEntry, error)
+}
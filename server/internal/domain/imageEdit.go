@@ -1,10 +1,28 @@
 package domain
 
+// PointLabel は座標が抽出したいホールドか、除外したい部分かを表す。値は SAM の point_labels に合わせる
+type PointLabel int
+
+const (
+	PointLabelNegative PointLabel = 0
+	PointLabelPositive PointLabel = 1
+)
+
 type Point struct {
-	X float64 `json:"x"`
-	Y float64 `json:"y"`
+	X     float64    `json:"x"`
+	Y     float64    `json:"y"`
+	Label PointLabel `json:"label"`
+}
+
+// Box は抽出する範囲を囲む矩形。(X1, Y1) が左上、(X2, Y2) が右下
+type Box struct {
+	X1 float64 `json:"x1"`
+	Y1 float64 `json:"y1"`
+	X2 float64 `json:"x2"`
+	Y2 float64 `json:"y2"`
 }
 
 type IImageEditService interface {
-	Extraction([]byte, []Point) ([]byte, []byte, error)
+	// Extraction は座標と矩形（nil なら指定なし）で指定した部分を抽出し、加工済み画像とマスクを返す
+	Extraction(image []byte, points []Point, box *Box) ([]byte, []byte, error)
 }
@@ -5,4 +5,7 @@ import "io"
 type IImageStorageService interface {
 	UploadImage(io.Reader, string, string) error
 	GeneratePresignedGetURL(string, string) (string, error)
+	DownloadImage(string) ([]byte, error)
+	// DeleteImage はオブジェクトを削除する。存在しない場合もエラーにしない
+	DeleteImage(string) error
 }
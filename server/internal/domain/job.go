@@ -0,0 +1,20 @@
+package domain
+
+// JobStage はホールド抽出セッションの処理段階
+type JobStage string
+
+const (
+	JobStageQueued      JobStage = "queued"
+	JobStageUploading   JobStage = "uploading"
+	JobStageExtracting  JobStage = "extracting"
+	JobStageCompositing JobStage = "compositing"
+	JobStageStoring     JobStage = "storing"
+	JobStageGenerating  JobStage = "generating"
+	JobStageDone        JobStage = "done"
+	JobStageFailed      JobStage = "failed"
+)
+
+// IsFinished は以降の状態遷移が起きない段階かどうかを返す
+func (s JobStage) IsFinished() bool {
+	return s == JobStageDone || s == JobStageFailed
+}
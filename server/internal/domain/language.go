@@ -0,0 +1,60 @@
+package domain
+
+import "strings"
+
+// Language は投稿文を生成する言語
+type Language string
+
+const (
+	LanguageJapanese Language = "ja"
+	LanguageEnglish  Language = "en"
+	LanguageKorean   Language = "ko"
+)
+
+// requiredHashtags は言語ごとに投稿へ必ず含めるハッシュタグ
+var requiredHashtags = map[Language][]string{
+	LanguageJapanese: {"#climbinsight", "#ボルダリング"},
+	LanguageEnglish:  {"#climbinsight", "#bouldering"},
+	LanguageKorean:   {"#climbinsight", "#볼더링"},
+}
+
+// IsSupported は対応している言語かどうかを返す
+func (l Language) IsSupported() bool {
+	_, ok := requiredHashtags[l]
+	return ok
+}
+
+// RequiredHashtags は投稿に必ず含めるハッシュタグを返す。未対応の言語は日本語として扱う
+func (l Language) RequiredHashtags() []string {
+	tags, ok := requiredHashtags[l]
+	if !ok {
+		tags = requiredHashtags[LanguageJapanese]
+	}
+	return append([]string(nil), tags...)
+}
+
+// hashtagTrailingPunctuation はハッシュタグの末尾に紛れ込みやすい区切り文字
+const hashtagTrailingPunctuation = ",.、。，．!！?？"
+
+// Hashtag は語句をハッシュタグに変換する。ハッシュタグは空白で途切れるので取り除き、
+// 空になる場合は空文字を返す
+func Hashtag(word string) string {
+	tag := strings.TrimLeft(strings.TrimSpace(word), "#＃")
+	tag = strings.Join(strings.Fields(tag), "")
+	tag = strings.TrimRight(tag, hashtagTrailingPunctuation)
+	if tag == "" {
+		return ""
+	}
+	return "#" + tag
+}
+
+// Hashtags は必須のハッシュタグに続けて語句をハッシュタグにしたものを返す
+func (l Language) Hashtags(words ...string) []string {
+	tags := l.RequiredHashtags()
+	for _, w := range words {
+		if tag := Hashtag(w); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -1,12 +1,55 @@
 package domain
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrCandidateLimit は投稿文の候補を追加すると上限を超えるため、追加しなかったことを表す
+var ErrCandidateLimit = errors.New("caption candidate limit exceeded")
+
 type Result struct {
-	Image   string
+	Image string
+	// Renditions はサイズ別の画像のURL（キーはサイズ名）
+	Renditions map[string]string
+	// OriginalKey と MaskKey は加工済み画像を作り直すための元の画像とマスクのオブジェクトキー
+	OriginalKey string
+	MaskKey     string
+	// Content は先頭の候補の本文とハッシュタグをつなげた投稿用の文字列
 	Content string
+	// Captions は生成された投稿文の候補
+	Captions []Caption
+	// Stage は現在の処理段階
+	Stage JobStage
+	// FailedStage と Reason は Stage が failed のときのみ設定される
+	FailedStage JobStage
+	Reason      string
+}
+
+// ProcessedImage は加工済み画像のURLと、作り直すために必要な元の画像とマスクのオブジェクトキー
+type ProcessedImage struct {
+	URL         string
+	Renditions  map[string]string
+	OriginalKey string
+	MaskKey     string
 }
 
 type ISessionStoreService interface {
-	SaveProcessedImage(sessionId string, imageUrl string) error
-	SaveGeneratedContent(sessionId string, content string) error
+	SaveJobStage(sessionId string, stage JobStage) error
+	SaveJobFailure(sessionId string, stage JobStage, reason string) error
+	// SaveProcessedImage は加工済み画像を保存する。done の後に呼ばれた場合は画像を差し替える
+	SaveProcessedImage(sessionId string, image ProcessedImage) error
+	// SaveGeneratedContents は投稿文の候補を既存の候補の後ろに追加する。
+	// maxCandidates が 0 より大きく、追加すると候補の数が超える場合は何も追加せず ErrCandidateLimit を返す
+	SaveGeneratedContents(sessionId string, captions []Caption, maxCandidates int) error
+	// SaveContentDelta は candidate 番目の候補の生成途中の差分をイベントとして記録する
+	SaveContentDelta(sessionId string, candidate int, delta CaptionDelta) error
+	// GetResult はセッションが存在しない場合 nil を返す
 	GetResult(sessionId string) (*Result, error)
+	// GetEvents は ID が afterId より大きいイベントを発生順に返す
+	GetEvents(sessionId string, afterId int64) ([]Event, error)
+	// Subscribe はセッションが更新されるたびに通知するチャネルを返す。
+	// 通知は取りこぼす可能性があるため、受信側は定期的な再取得と併用すること。
+	// チャネルは ctx の終了時に閉じられる
+	Subscribe(ctx context.Context, sessionId string) (<-chan struct{}, error)
 }
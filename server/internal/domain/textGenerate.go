@@ -1,5 +1,46 @@
 package domain
 
+// Tone は投稿文の口調
+type Tone string
+
+const (
+	ToneCasual    Tone = "casual"
+	ToneTechnical Tone = "technical"
+	ToneHumble    Tone = "humble"
+	ToneHype      Tone = "hype"
+)
+
+// EmojiDensity は投稿文に含める絵文字の量
+type EmojiDensity string
+
+const (
+	EmojiNone EmojiDensity = "none"
+	EmojiFew  EmojiDensity = "few"
+	EmojiMany EmojiDensity = "many"
+)
+
+// CaptionRequest は投稿文の生成に使う情報。
+// Impression / Tone / TargetLength / EmojiDensity / Language は空ならサービス側の既定値を使う
+type CaptionRequest struct {
+	Grade        string
+	Gym          string
+	Style        string
+	TryCount     uint
+	Impression   string
+	Tone         Tone
+	TargetLength int
+	EmojiDensity EmojiDensity
+	Language     Language
+}
+
+// CaptionDelta は生成途中の投稿文の差分。Reset が true の場合はそれまでの差分を破棄して書き直す
+type CaptionDelta struct {
+	Text  string
+	Reset bool
+}
+
 type ITextGenerateService interface {
-	Generate(grade, gym, style string, tryCount uint) (string, error)
+	// Generate は本文とハッシュタグに分けた投稿文を返す。必須のハッシュタグは常に含まれる。
+	// onDelta が nil でなければ生成途中のテキストを順に渡す
+	Generate(req CaptionRequest, onDelta func(CaptionDelta)) (Caption, error)
 }
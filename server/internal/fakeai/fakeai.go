@@ -0,0 +1,165 @@
+// Package fakeai はAIサービスの代わりに使う、結果が決まった抽出を返すサーバー。
+// 本番と同じ zip（HTTP）と gRPC のプロトコルを話すため、GCP なしでエンドツーエンドに動かせる
+package fakeai
+
+import (
+	"archive/zip"
+	"bytes"
+	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/imaging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// maxRequestBytes は受け付ける zip の大きさの上限
+const maxRequestBytes = 64 << 20
+
+// backgroundAlpha はAIサービスと同じく、加工済み画像の背景に残す不透明度
+const backgroundAlpha = 25
+
+// Extract は画像から Segment でマスクを作り、背景を半透明にした加工済み画像とマスクを PNG で返す
+func Extract(data []byte, points []domain.Point, box *domain.Box) ([]byte, []byte, error) {
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	mask := Segment(img, points, box)
+
+	// デコードした画像はここでしか使わないので、そのまま不透明度を書き換える
+	result := imaging.ToNRGBA(img)
+	for i, v := range mask.Pix {
+		if v == 0 {
+			result.Pix[i*4+3] = backgroundAlpha
+		} else {
+			result.Pix[i*4+3] = 0xFF
+		}
+	}
+
+	resultPNG, _, err := imaging.Encode(result, imaging.FormatPNG)
+	if err != nil {
+		return nil, nil, err
+	}
+	maskPNG, _, err := imaging.Encode(mask, imaging.FormatPNG)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resultPNG, maskPNG, nil
+}
+
+// NewHandler はAIサービスと同じ /process（zip の入出力）と /healthz を提供するハンドラを返す
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	})
+	mux.HandleFunc("POST /process", handleProcess)
+	return mux
+}
+
+// pointsPayload は points.json の中身。label が無い座標は positive として扱う
+type pointsPayload struct {
+	Points []struct {
+		X     float64            `json:"x"`
+		Y     float64            `json:"y"`
+		Label *domain.PointLabel `json:"label"`
+	} `json:"points"`
+	Box *domain.Box `json:"box"`
+}
+
+func handleProcess(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	imageData, points, box, err := parseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, mask, err := Extract(imageData, points, box)
+	if err != nil {
+		log.Printf("❌ 抽出に失敗: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{{"result_image.bin", result}, {"mask_image.bin", mask}} {
+		fw, err := zw.Create(entry.name)
+		if err == nil {
+			_, err = fw.Write(entry.data)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=result.zip")
+	_, _ = w.Write(out.Bytes())
+}
+
+// parseRequest は image.bin と points.json を含む zip を読み取る
+func parseRequest(body []byte) ([]byte, []domain.Point, *domain.Box, error) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid zip: %w", err)
+	}
+
+	var imageData, pointsJSON []byte
+	for _, f := range zr.File {
+		if f.Name != "image.bin" && f.Name != "points.json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxRequestBytes))
+		rc.Close()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if f.Name == "image.bin" {
+			imageData = data
+		} else {
+			pointsJSON = data
+		}
+	}
+	if imageData == nil {
+		return nil, nil, nil, errors.New("image.bin not found in zip file")
+	}
+	if pointsJSON == nil {
+		return nil, nil, nil, errors.New("points.json not found in zip file")
+	}
+
+	var payload pointsPayload
+	if err := json.Unmarshal(pointsJSON, &payload); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid points.json: %w", err)
+	}
+	points := make([]domain.Point, 0, len(payload.Points))
+	for _, p := range payload.Points {
+		label := domain.PointLabelPositive
+		if p.Label != nil {
+			label = *p.Label
+		}
+		points = append(points, domain.Point{X: p.X, Y: p.Y, Label: label})
+	}
+	return imageData, points, payload.Box, nil
+}
@@ -0,0 +1,77 @@
+package fakeai
+
+import (
+	"bytes"
+	"climbinsight/server/internal/aipb"
+	"climbinsight/server/internal/domain"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chunkSize はレスポンスで1つのメッセージに入れる画像のバイト数
+const chunkSize = 1 << 20
+
+// GRPCServer は proto/ai.proto の ImageEditService を Extract で実装する
+type GRPCServer struct {
+	aipb.UnimplementedImageEditServiceServer
+}
+
+func (GRPCServer) Extract(stream aipb.ImageEditService_ExtractServer) error {
+	var prompt *aipb.Prompt
+	var imageData bytes.Buffer
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch payload := req.Payload.(type) {
+		case *aipb.ExtractRequest_Prompt:
+			prompt = payload.Prompt
+		case *aipb.ExtractRequest_ImageChunk:
+			if imageData.Len()+len(payload.ImageChunk) > maxRequestBytes {
+				return status.Error(codes.ResourceExhausted, "image is too large")
+			}
+			imageData.Write(payload.ImageChunk)
+		}
+	}
+	if prompt == nil {
+		return status.Error(codes.InvalidArgument, "prompt is required")
+	}
+
+	points := make([]domain.Point, 0, len(prompt.Points))
+	for _, p := range prompt.Points {
+		label := domain.PointLabelPositive
+		if p.Label == aipb.PointLabel_POINT_LABEL_NEGATIVE {
+			label = domain.PointLabelNegative
+		}
+		points = append(points, domain.Point{X: p.X, Y: p.Y, Label: label})
+	}
+	var box *domain.Box
+	if b := prompt.Box; b != nil {
+		box = &domain.Box{X1: b.X1, Y1: b.Y1, X2: b.X2, Y2: b.Y2}
+	}
+
+	result, mask, err := Extract(imageData.Bytes(), points, box)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	for offset := 0; offset < len(result); offset += chunkSize {
+		chunk := result[offset:min(offset+chunkSize, len(result))]
+		if err := stream.Send(&aipb.ExtractResponse{Payload: &aipb.ExtractResponse_ResultChunk{ResultChunk: chunk}}); err != nil {
+			return err
+		}
+	}
+	for offset := 0; offset < len(mask); offset += chunkSize {
+		chunk := mask[offset:min(offset+chunkSize, len(mask))]
+		if err := stream.Send(&aipb.ExtractResponse{Payload: &aipb.ExtractResponse_MaskChunk{MaskChunk: chunk}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package fakeai
+
+import (
+	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/imaging"
+	"image"
+)
+
+// colorTolerance は塗りつぶしで同じ領域とみなす、起点の色との差（RGB 各チャンネルの差の最大値）
+const colorTolerance = 40
+
+// Segment はAIサービスの代わりに、座標を起点に色の近い画素を塗りつぶして（flood fill）マスクを作る。
+// positive の座標から塗りつぶした領域を合わせ、negative の座標から塗りつぶした領域を取り除く。
+// 矩形があればその内側だけを対象にし、positive の座標が無ければ矩形全体を抽出する
+func Segment(img image.Image, points []domain.Point, box *domain.Box) *image.Gray {
+	src := imaging.ToNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	region := image.Rect(0, 0, w, h)
+	if box != nil {
+		region = image.Rect(int(box.X1), int(box.Y1), int(box.X2+0.5), int(box.Y2+0.5)).Intersect(region)
+	}
+
+	mask := image.NewGray(src.Rect)
+	positive := false
+	for _, p := range points {
+		if p.Label != domain.PointLabelNegative {
+			positive = true
+			floodFill(src, mask, region, image.Pt(int(p.X), int(p.Y)), 0xFF)
+		}
+	}
+	if !positive && box != nil {
+		for y := region.Min.Y; y < region.Max.Y; y++ {
+			for x := region.Min.X; x < region.Max.X; x++ {
+				mask.Pix[y*mask.Stride+x] = 0xFF
+			}
+		}
+	}
+
+	for _, p := range points {
+		if p.Label == domain.PointLabelNegative {
+			exclude := image.NewGray(src.Rect)
+			floodFill(src, exclude, region, image.Pt(int(p.X), int(p.Y)), 0xFF)
+			for i, v := range exclude.Pix {
+				if v != 0 {
+					mask.Pix[i] = 0
+				}
+			}
+		}
+	}
+	return mask
+}
+
+// floodFill は seed と色の近い画素を上下左右につないで dst に value を書き込む
+func floodFill(src *image.NRGBA, dst *image.Gray, region image.Rectangle, seed image.Point, value uint8) {
+	if !seed.In(region) {
+		return
+	}
+	si := seed.Y*src.Stride + seed.X*4
+	base := src.Pix[si : si+3]
+
+	visited := make([]bool, len(dst.Pix))
+	stack := []image.Point{seed}
+	visited[seed.Y*dst.Stride+seed.X] = true
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		dst.Pix[p.Y*dst.Stride+p.X] = value
+
+		for _, n := range [4]image.Point{{p.X - 1, p.Y}, {p.X + 1, p.Y}, {p.X, p.Y - 1}, {p.X, p.Y + 1}} {
+			if !n.In(region) || visited[n.Y*dst.Stride+n.X] {
+				continue
+			}
+			visited[n.Y*dst.Stride+n.X] = true
+			if similar(src.Pix[n.Y*src.Stride+n.X*4:], base) {
+				stack = append(stack, n)
+			}
+		}
+	}
+}
+
+func similar(pix []uint8, base []uint8) bool {
+	for c := 0; c < 3; c++ {
+		d := int(pix[c]) - int(base[c])
+		if d < -colorTolerance || d > colorTolerance {
+			return false
+		}
+	}
+	return true
+}
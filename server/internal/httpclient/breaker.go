@@ -0,0 +1,81 @@
+package httpclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen は接続先の障害中でリクエストを送らなかったことを表す
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	// breakerHalfOpen は復旧を確認するため、1つのリクエストだけを通している状態
+	breakerHalfOpen
+)
+
+// CircuitBreaker は連続して失敗した（リトライしても成功しなかった）接続先へのリクエストを一定時間止める。
+// 止めている間は待たずに ErrCircuitOpen を返し、時間が経ったら1つだけリクエストを通して復旧を確認する
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+}
+
+// NewCircuitBreaker は threshold 回連続で失敗したら cooldown の間リクエストを止める。
+// threshold が 0 なら止めない
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow はリクエストを送ってよいかを返す。true を返した場合は Success か Failure で結果を記録する
+func (b *CircuitBreaker) Allow() bool {
+	if b.threshold == 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// 復旧の確認中は結果が出るまで他のリクエストを止める
+		return false
+	}
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	if b.threshold == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+func (b *CircuitBreaker) Failure() {
+	if b.threshold == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
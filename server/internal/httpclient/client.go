@@ -0,0 +1,112 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Client はリトライとサーキットブレーカーを備えた HTTP クライアント。
+// 接続先ごとに1つ作って使い回す
+type Client struct {
+	retry   RetryPolicy
+	breaker *CircuitBreaker
+
+	// newClient は認証付きの *http.Client などを作る。作成に成功したものを使い回す
+	newClient func() (*http.Client, error)
+	mu        sync.Mutex
+	client    *http.Client
+}
+
+func NewClient(newClient func() (*http.Client, error), retry RetryPolicy, breaker *CircuitBreaker) *Client {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	if breaker == nil {
+		breaker = NewCircuitBreaker(0, 0)
+	}
+	return &Client{retry: retry, breaker: breaker, newClient: newClient}
+}
+
+func (c *Client) httpClient() (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+	client, err := c.newClient()
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	return client, nil
+}
+
+// Do は req を送信し、通信エラーとリトライ可能なステータスコードの場合は待ってから再送する。
+// 再送のために本文は req.GetBody で作り直すので、http.NewRequestWithContext で作ったリクエストを渡す。
+// 全体の期限は req のコンテキストで指定する。リトライしても失敗した場合は最後のレスポンスを返す
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	client, err := c.httpClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client: %w", err)
+	}
+	if !c.breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	resp, err := c.do(client, req)
+	// 接続先が応答している（5xx 以外）なら障害とはみなさない
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		c.breaker.Failure()
+	} else {
+		c.breaker.Success()
+	}
+	return resp, err
+}
+
+func (c *Client) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	canRetry := req.Body == nil || req.GetBody != nil
+
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		resp, err := client.Do(r)
+		retryable := err != nil || retryableStatus[resp.StatusCode]
+		if !retryable || !canRetry || attempt+1 >= c.retry.MaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := c.retry.delay(attempt, resp)
+		if resp != nil {
+			// コネクションを再利用できるよう本文を読み捨てる
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, fmt.Errorf("gave up after %d attempts: %w", attempt+1, err)
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,53 @@
+package httpclient
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy はリトライの設定
+type RetryPolicy struct {
+	// MaxAttempts は最初の1回を含む試行回数の上限。1 ならリトライしない
+	MaxAttempts int
+	// BaseDelay は1回目のリトライまでの待ち時間の上限。以降は2倍ずつ増やす
+	BaseDelay time.Duration
+	// MaxDelay は待ち時間の上限
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// retryableStatus はリトライするステータスコード。それ以外はサーバーの応答として呼び出し元に返す
+var retryableStatus = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// delay は attempt 回目（0 始まり）の失敗の後に待つ時間を返す。
+// 同時に失敗したリクエストが一斉に再送しないよう、0 から上限までの間でランダムに選ぶ
+func (p RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	// Retry-After（秒数）が指定されていれば従う
+	if resp != nil {
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && sec >= 0 {
+			return min(time.Duration(sec)*time.Second, p.MaxDelay)
+		}
+	}
+	ceiling := p.MaxDelay
+	if attempt < 30 {
+		ceiling = min(p.BaseDelay<<attempt, p.MaxDelay)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
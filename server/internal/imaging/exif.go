@@ -0,0 +1,167 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	tagOrientation        = 0x0112
+	tagExifIFDPointer     = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+
+	tiffTypeASCII = 2
+	tiffTypeShort = 3
+	tiffTypeLong  = 4
+)
+
+// exifHeader は JPEG の APP1 や HEIC の Exif アイテムで TIFF データの前に付くヘッダー
+var exifHeader = []byte("Exif\x00\x00")
+
+// exifInfo は EXIF から読み取る項目。それ以外のタグ（位置情報や端末情報など）は保存しない
+type exifInfo struct {
+	// Orientation は 1〜8 の向き。タグが無い場合は 0
+	Orientation int
+	// DateTimeOriginal と OffsetTimeOriginal は撮影日時（"2006:01:02 15:04:05" / "+09:00"）
+	DateTimeOriginal   string
+	OffsetTimeOriginal string
+}
+
+func (ei exifInfo) hasCaptureTime() bool {
+	return ei.DateTimeOriginal != ""
+}
+
+// parseExif は TIFF 形式の EXIF データを読み取る。先頭の "Exif\0\0" は省略できる
+func parseExif(data []byte) (exifInfo, error) {
+	data = bytes.TrimPrefix(data, exifHeader)
+	if len(data) < 8 {
+		return exifInfo{}, errors.New("exif: truncated header")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[0:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return exifInfo{}, errors.New("exif: invalid byte order")
+	}
+
+	var info exifInfo
+	var exifIFD uint32
+	err := eachIFDEntry(data, order, order.Uint32(data[4:8]), func(tag, typ uint16, count uint32, value []byte) {
+		switch {
+		case tag == tagOrientation && typ == tiffTypeShort:
+			info.Orientation = int(order.Uint16(value[0:2]))
+		case tag == tagExifIFDPointer && typ == tiffTypeLong:
+			exifIFD = order.Uint32(value[0:4])
+		}
+	})
+	if err != nil {
+		return exifInfo{}, err
+	}
+	if exifIFD == 0 {
+		return info, nil
+	}
+
+	err = eachIFDEntry(data, order, exifIFD, func(tag, typ uint16, count uint32, value []byte) {
+		if typ != tiffTypeASCII {
+			return
+		}
+		switch tag {
+		case tagDateTimeOriginal:
+			info.DateTimeOriginal = asciiValue(data, order, count, value)
+		case tagOffsetTimeOriginal:
+			info.OffsetTimeOriginal = asciiValue(data, order, count, value)
+		}
+	})
+	if err != nil {
+		return exifInfo{}, err
+	}
+	return info, nil
+}
+
+// eachIFDEntry は offset にある IFD のエントリを順に fn に渡す。value は 4 バイトの値フィールド
+func eachIFDEntry(data []byte, order binary.ByteOrder, offset uint32, fn func(tag, typ uint16, count uint32, value []byte)) error {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return errors.New("exif: IFD out of range")
+	}
+	count := int(order.Uint16(data[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(data) {
+		return errors.New("exif: IFD out of range")
+	}
+	for i := 0; i < count; i++ {
+		entry := data[start+i*12 : start+(i+1)*12]
+		fn(order.Uint16(entry[0:2]), order.Uint16(entry[2:4]), order.Uint32(entry[4:8]), entry[8:12])
+	}
+	return nil
+}
+
+// asciiValue は ASCII 型の値を読み取る。4 バイトを超える値はオフセットの先にある
+func asciiValue(data []byte, order binary.ByteOrder, count uint32, value []byte) string {
+	var raw []byte
+	if count <= 4 {
+		raw = value[:count]
+	} else {
+		offset := order.Uint32(value)
+		if uint64(offset)+uint64(count) > uint64(len(data)) {
+			return ""
+		}
+		raw = data[offset : offset+count]
+	}
+	return string(bytes.TrimRight(raw, "\x00 "))
+}
+
+// buildCaptureExif は撮影日時だけを含む TIFF 形式の EXIF データを作る。
+// 向きは正規化済みなので書き込まない
+func buildCaptureExif(info exifInfo) []byte {
+	type asciiEntry struct {
+		tag   uint16
+		value string
+	}
+	entries := []asciiEntry{{tagDateTimeOriginal, info.DateTimeOriginal}}
+	if info.OffsetTimeOriginal != "" {
+		entries = append(entries, asciiEntry{tagOffsetTimeOriginal, info.OffsetTimeOriginal})
+	}
+
+	order := binary.BigEndian
+	const ifd0Offset = 8
+	const exifIFDOffset = ifd0Offset + 2 + 12 + 4
+	dataOffset := exifIFDOffset + 2 + len(entries)*12 + 4
+
+	buf := make([]byte, dataOffset)
+	copy(buf, "MM\x00*")
+	order.PutUint32(buf[4:], ifd0Offset)
+
+	// IFD0 には Exif IFD へのポインタだけを置く
+	order.PutUint16(buf[ifd0Offset:], 1)
+	putIFDEntry(buf[ifd0Offset+2:], order, tagExifIFDPointer, tiffTypeLong, 1, exifIFDOffset)
+
+	order.PutUint16(buf[exifIFDOffset:], uint16(len(entries)))
+	for i, e := range entries {
+		value := append([]byte(e.value), 0)
+		entry := buf[exifIFDOffset+2+i*12:]
+		if len(value) <= 4 {
+			putIFDEntry(entry, order, e.tag, tiffTypeASCII, uint32(len(value)), 0)
+			copy(entry[8:12], value)
+			continue
+		}
+		putIFDEntry(entry, order, e.tag, tiffTypeASCII, uint32(len(value)), uint32(len(buf)))
+		buf = append(buf, value...)
+		if len(buf)%2 == 1 {
+			buf = append(buf, 0)
+		}
+	}
+	return buf
+}
+
+func putIFDEntry(b []byte, order binary.ByteOrder, tag, typ uint16, count, value uint32) {
+	order.PutUint16(b[0:], tag)
+	order.PutUint16(b[2:], typ)
+	order.PutUint32(b[4:], count)
+	order.PutUint32(b[8:], value)
+}
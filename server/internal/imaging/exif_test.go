@@ -0,0 +1,90 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseExif(t *testing.T) {
+	full := exifInfo{Orientation: 6, DateTimeOriginal: testCaptureTime, OffsetTimeOriginal: testCaptureTZ}
+	tests := []struct {
+		name    string
+		data    []byte
+		want    exifInfo
+		wantErr bool
+	}{
+		{"little endian", buildTestExif(binary.LittleEndian, 6), full, false},
+		{"big endian", buildTestExif(binary.BigEndian, 6), full, false},
+		{"with header", append(bytes.Clone(exifHeader), buildTestExif(binary.BigEndian, 6)...), full, false},
+		{"without orientation", buildTestExif(binary.LittleEndian, 0), exifInfo{DateTimeOriginal: testCaptureTime, OffsetTimeOriginal: testCaptureTZ}, false},
+		{"orientation with wrong type", buildTIFF(binary.BigEndian, []tiffEntry{
+			{tag: tagOrientation, typ: tiffTypeLong, count: 1, value: []byte{0, 0, 0, 6}},
+		}), exifInfo{}, false},
+		{"short value inline", buildTIFF(binary.BigEndian, []tiffEntry{
+			{tag: tagExifIFDPointer, typ: tiffTypeLong, count: 1, ifd: 1},
+		}, []tiffEntry{asciiEntry(tagOffsetTimeOriginal, "Z")}), exifInfo{OffsetTimeOriginal: "Z"}, false},
+		{"ascii value out of range", buildTIFF(binary.BigEndian, []tiffEntry{
+			{tag: tagExifIFDPointer, typ: tiffTypeLong, count: 1, ifd: 1},
+		}, []tiffEntry{{tag: tagDateTimeOriginal, typ: tiffTypeASCII, count: 20, value: []byte{0, 0, 0xFF, 0xFF}}}), exifInfo{}, false},
+		{"ascii count overflows offset", buildTIFF(binary.BigEndian, []tiffEntry{
+			{tag: tagExifIFDPointer, typ: tiffTypeLong, count: 1, ifd: 1},
+		}, []tiffEntry{{tag: tagDateTimeOriginal, typ: tiffTypeASCII, count: 0xFFFFFFFF, value: []byte{0, 0, 0, 8}}}), exifInfo{}, false},
+		{"truncated header", []byte("MM\x00*\x00\x00"), exifInfo{}, true},
+		{"invalid byte order", []byte("XX\x00*\x00\x00\x00\x08\x00\x00"), exifInfo{}, true},
+		{"IFD0 out of range", []byte("MM\x00*\xFF\xFF\xFF\xFF"), exifInfo{}, true},
+		{"IFD0 at the end", []byte("MM\x00*\x00\x00\x00\x08"), exifInfo{}, true},
+		{"too many entries", []byte("MM\x00*\x00\x00\x00\x08\x00\x05\x01\x12\x00\x03"), exifInfo{}, true},
+		{"exif IFD out of range", buildTIFF(binary.LittleEndian, []tiffEntry{
+			{tag: tagExifIFDPointer, typ: tiffTypeLong, count: 1, value: []byte{0xFF, 0xFF, 0, 0}},
+		}), exifInfo{}, true},
+		{"empty", nil, exifInfo{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExif(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseExif = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCaptureExif(t *testing.T) {
+	tests := []exifInfo{
+		{DateTimeOriginal: testCaptureTime},
+		{DateTimeOriginal: testCaptureTime, OffsetTimeOriginal: testCaptureTZ},
+		{DateTimeOriginal: testCaptureTime, OffsetTimeOriginal: "Z"},
+	}
+	for _, info := range tests {
+		exif := buildCaptureExif(info)
+		got, err := parseExif(exif)
+		if err != nil {
+			t.Fatalf("%+v: parseExif: %v", info, err)
+		}
+		if got != info {
+			t.Errorf("parseExif(buildCaptureExif(%+v)) = %+v", info, got)
+		}
+	}
+}
+
+func TestCaptureExif(t *testing.T) {
+	info := exifInfo{Orientation: 6, DateTimeOriginal: testCaptureTime}
+	if exif := captureExif(info, NormalizeOptions{}); exif != nil {
+		t.Errorf("captureExif without KeepCaptureTime = %x, want nil", exif)
+	}
+	if exif := captureExif(exifInfo{Orientation: 6}, NormalizeOptions{KeepCaptureTime: true}); exif != nil {
+		t.Errorf("captureExif without capture time = %x, want nil", exif)
+	}
+	got, err := parseExif(captureExif(info, NormalizeOptions{KeepCaptureTime: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 向きは正規化済みなので書き込まない
+	if want := (exifInfo{DateTimeOriginal: testCaptureTime}); got != want {
+		t.Errorf("captureExif = %+v, want %+v", got, want)
+	}
+}
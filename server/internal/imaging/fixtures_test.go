@@ -0,0 +1,295 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// テスト用の画像は端末名と位置情報を持つ EXIF と XMP を含み、いずれも出力に残ってはいけない
+const (
+	testMake        = "Apple"
+	testModel       = "iPhone 15"
+	testCaptureTime = "2024:05:01 10:20:30"
+	testCaptureTZ   = "+09:00"
+
+	tagMake          = 0x010F
+	tagModel         = 0x0110
+	tagGPSIFDPtr     = 0x8825
+	tagGPSLatRef     = 0x0001
+	tagGPSLatitude   = 0x0002
+	tiffTypeRational = 5
+)
+
+var testXMP = []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><tiff:Model>` + testModel + `</tiff:Model></x:xmpmeta>`)
+
+// tiffByteOrder は TIFF を組み立てるためのバイトオーダー
+type tiffByteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffEntry はテスト用の IFD エントリ。ifd が 0 より大きければ、その番号の IFD へのポインタになる
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+	ifd   int
+}
+
+// buildTIFF は IFD を順に並べた TIFF を作る。4 バイトを超える値は各 IFD の直後に置く
+func buildTIFF(order tiffByteOrder, ifds ...[]tiffEntry) []byte {
+	offsets := make([]int, len(ifds))
+	pos := 8
+	for i, entries := range ifds {
+		offsets[i] = pos
+		pos += 2 + len(entries)*12 + 4
+		for _, e := range entries {
+			if len(e.value) > 4 {
+				pos += len(e.value) + len(e.value)%2
+			}
+		}
+	}
+
+	buf := make([]byte, 8, pos)
+	if order.Uint16([]byte{1, 0}) == 1 {
+		copy(buf, "II*\x00")
+	} else {
+		copy(buf, "MM\x00*")
+	}
+	order.PutUint32(buf[4:], 8)
+	for i, entries := range ifds {
+		dataPos := offsets[i] + 2 + len(entries)*12 + 4
+		var data []byte
+		buf = order.AppendUint16(buf, uint16(len(entries)))
+		for _, e := range entries {
+			buf = order.AppendUint16(buf, e.tag)
+			buf = order.AppendUint16(buf, e.typ)
+			buf = order.AppendUint32(buf, e.count)
+			switch {
+			case e.ifd > 0:
+				buf = order.AppendUint32(buf, uint32(offsets[e.ifd]))
+			case len(e.value) > 4:
+				buf = order.AppendUint32(buf, uint32(dataPos+len(data)))
+				data = append(data, e.value...)
+				if len(e.value)%2 == 1 {
+					data = append(data, 0)
+				}
+			default:
+				var value [4]byte
+				copy(value[:], e.value)
+				buf = append(buf, value[:]...)
+			}
+		}
+		buf = order.AppendUint32(buf, 0)
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+func asciiEntry(tag uint16, value string) tiffEntry {
+	return tiffEntry{tag: tag, typ: tiffTypeASCII, count: uint32(len(value) + 1), value: append([]byte(value), 0)}
+}
+
+// buildTestExif は端末情報・位置情報・撮影日時と、orientation が 0 でなければ向きを持つ TIFF を作る
+func buildTestExif(order tiffByteOrder, orientation int) []byte {
+	ifd0 := []tiffEntry{asciiEntry(tagMake, testMake), asciiEntry(tagModel, testModel)}
+	if orientation != 0 {
+		ifd0 = append(ifd0, tiffEntry{tag: tagOrientation, typ: tiffTypeShort, count: 1, value: order.AppendUint16(nil, uint16(orientation))})
+	}
+	ifd0 = append(ifd0,
+		tiffEntry{tag: tagExifIFDPointer, typ: tiffTypeLong, count: 1, ifd: 1},
+		tiffEntry{tag: tagGPSIFDPtr, typ: tiffTypeLong, count: 1, ifd: 2},
+	)
+	exifIFD := []tiffEntry{asciiEntry(tagDateTimeOriginal, testCaptureTime), asciiEntry(tagOffsetTimeOriginal, testCaptureTZ)}
+	var latitude []byte
+	for _, v := range []uint32{35, 1, 41, 1, 0, 1} {
+		latitude = order.AppendUint32(latitude, v)
+	}
+	gpsIFD := []tiffEntry{
+		asciiEntry(tagGPSLatRef, "N"),
+		{tag: tagGPSLatitude, typ: tiffTypeRational, count: 3, value: latitude},
+	}
+	return buildTIFF(order, ifd0, exifIFD, gpsIFD)
+}
+
+// quadrantColors は quadrantImage の左上・右上・左下・右下の色
+var quadrantColors = []color.NRGBA{
+	{R: 255, A: 255},
+	{G: 255, A: 255},
+	{B: 255, A: 255},
+	{R: 255, G: 255, B: 255, A: 255},
+}
+
+// quadrantImage は 32x16 の画像を4つに分け、quadrantColors で塗る
+func quadrantImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, quadrantColors[y/8*2+x/16])
+		}
+	}
+	return img
+}
+
+// quadrants は画像の4つの領域の中心の色が quadrantColors のどれに最も近いかを返す
+func quadrants(img image.Image) [4]int {
+	b := img.Bounds()
+	var got [4]int
+	for i := range got {
+		x := b.Min.X + b.Dx()/4 + i%2*b.Dx()/2
+		y := b.Min.Y + b.Dy()/4 + i/2*b.Dy()/2
+		c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		best := -1
+		for j, q := range quadrantColors {
+			d := absDiff(c.R, q.R) + absDiff(c.G, q.G) + absDiff(c.B, q.B)
+			if best < 0 || d < best {
+				best, got[i] = d, j
+			}
+		}
+	}
+	return got
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+func buildTestJPEG(t *testing.T, exif []byte) []byte {
+	t.Helper()
+
+	extra := [][]byte{
+		jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")),
+	}
+	if exif != nil {
+		extra = append(extra, jpegSegment(0xE1, append(bytes.Clone(exifHeader), exif...)))
+	}
+	extra = append(extra,
+		jpegSegment(0xE1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), testXMP...)),
+		jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01test profile")),
+		jpegSegment(0xFE, []byte(testModel)),
+	)
+	out, err := encodeJPEG(quadrantImage(), extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("invalid fixture: %v", err)
+	}
+	return out
+}
+
+func buildTestPNG(t *testing.T, exif []byte) []byte {
+	t.Helper()
+
+	extra := [][]byte{
+		pngChunk("sRGB", []byte{0}),
+		pngChunk("tEXt", []byte("Software\x00"+testModel)),
+		pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), testXMP...)),
+		pngChunk("tIME", []byte{0x07, 0xE8, 5, 1, 10, 20, 30}),
+	}
+	if exif != nil {
+		extra = append(extra, pngChunk("eXIf", exif))
+	}
+	out, err := encodePNG(quadrantImage(), extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// buildTestWebP は VP8X の拡張形式の WebP を作る。画像データは本物ではないため、デコードはできない
+func buildTestWebP(exif []byte) []byte {
+	vp8x := []byte{webpFlagXMP, 0, 0, 0, 31, 0, 0, 15, 0, 0}
+	chunks := [][]byte{webpChunk("VP8X", vp8x), webpChunk("ICCP", []byte("test profile")), webpChunk("VP8L", []byte("\x2f not a real bitstream"))}
+	if exif != nil {
+		vp8x[0] |= webpFlagExif
+		chunks[0] = webpChunk("VP8X", vp8x)
+		chunks = append(chunks, webpChunk("EXIF", exif))
+	}
+	chunks = append(chunks, webpChunk("XMP ", testXMP))
+
+	body := []byte("WEBP")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	out := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body)))
+	return append(out, body...)
+}
+
+// heicExifItemAt は buildTestHEIC の Exif アイテムの位置を返す
+func heicExifItemAt(data []byte) int {
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(exifHeader)))
+	return bytes.Index(data, append(header, exifHeader...))
+}
+
+func isoBox(boxType string, body ...[]byte) []byte {
+	size := 8
+	for _, b := range body {
+		size += len(b)
+	}
+	out := binary.BigEndian.AppendUint32(nil, uint32(size))
+	out = append(out, boxType...)
+	for _, b := range body {
+		out = append(out, b...)
+	}
+	return out
+}
+
+// infeBox はバージョン 2 の infe ボックスを作る。contentType は mime のアイテムだけに付ける
+func infeBox(id uint16, itemType, contentType string) []byte {
+	body := []byte{2, 0, 0, 0}
+	body = binary.BigEndian.AppendUint16(body, id)
+	body = append(body, 0, 0)
+	body = append(body, itemType...)
+	body = append(body, 0)
+	if contentType != "" {
+		body = append(body, contentType...)
+		body = append(body, 0)
+	}
+	return isoBox("infe", body)
+}
+
+// ilocBox はバージョン 0 の iloc ボックスを作る。各アイテムはファイル内の1つの範囲を持つ
+func ilocBox(items ...[3]uint32) []byte {
+	body := []byte{0, 0, 0, 0, 0x44, 0x00}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(items)))
+	for _, item := range items {
+		body = binary.BigEndian.AppendUint16(body, uint16(item[0]))
+		body = append(body, 0, 0)
+		body = binary.BigEndian.AppendUint16(body, 1)
+		body = binary.BigEndian.AppendUint32(body, item[1])
+		body = binary.BigEndian.AppendUint32(body, item[2])
+	}
+	return isoBox("iloc", body)
+}
+
+// buildTestHEIC は Exif と XMP のアイテムを mdat に持つ HEIC を作る。画像のアイテムは持たない
+func buildTestHEIC(exif []byte, irot byte) []byte {
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	iinf := isoBox("iinf", []byte{0, 0, 0, 0, 0, 2}, infeBox(1, "Exif", ""), infeBox(2, "mime", "application/rdf+xml"))
+	ispe := isoBox("ispe", []byte{0, 0, 0, 0, 0, 0, 0, 32, 0, 0, 0, 16})
+	iprp := isoBox("iprp", isoBox("ipco", ispe, isoBox("irot", []byte{irot})))
+	exifItem := binary.BigEndian.AppendUint32(nil, uint32(len(exifHeader)))
+	exifItem = append(exifItem, exifHeader...)
+	exifItem = append(exifItem, exif...)
+
+	meta := func(iloc []byte) []byte {
+		return isoBox("meta", []byte{0, 0, 0, 0}, iinf, iloc, iprp)
+	}
+	// iloc の大きさは位置によらないので、仮の位置で mdat の開始位置を求める
+	exifAt := len(ftyp) + len(meta(ilocBox([3]uint32{}, [3]uint32{}))) + 8
+	xmpAt := exifAt + len(exifItem)
+	iloc := ilocBox(
+		[3]uint32{1, uint32(exifAt), uint32(len(exifItem))},
+		[3]uint32{2, uint32(xmpAt), uint32(len(testXMP))},
+	)
+	return bytes.Join([][]byte{ftyp, meta(iloc), isoBox("mdat", exifItem, testXMP)}, nil)
+}
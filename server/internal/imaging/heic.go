@@ -0,0 +1,411 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// heicBrands は HEIF/HEIC として受け付ける ftyp のブランド
+var heicBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true,
+	"hevc": true, "hevx": true, "mif1": true, "msf1": true,
+}
+
+// isHEIC は ISO BMFF の ftyp ボックスのブランドから HEIC かどうかを判定する
+func isHEIC(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(data[0:4]))
+	if size < 12 || size > len(data) {
+		return false
+	}
+	if heicBrands[string(data[8:12])] {
+		return true
+	}
+	// 互換ブランドの一覧（minor_version の後ろ）も確認する
+	for i := 16; i+4 <= size; i += 4 {
+		if heicBrands[string(data[i:i+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+// heicDimensions は meta/iprp/ipco 内の ispe ボックスから画像サイズを読み取る。
+// 複数ある場合（サムネイルなど）は最も大きいものを返す
+func heicDimensions(data []byte) (int, int, error) {
+	meta, ok := findBox(data, "meta")
+	if !ok || len(meta) < 4 {
+		return 0, 0, errors.New("meta box not found")
+	}
+	// meta は FullBox なので version と flags を読み飛ばす
+	iprp, ok := findBox(meta[4:], "iprp")
+	if !ok {
+		return 0, 0, errors.New("iprp box not found")
+	}
+	ipco, ok := findBox(iprp, "ipco")
+	if !ok {
+		return 0, 0, errors.New("ipco box not found")
+	}
+
+	width, height := 0, 0
+	err := eachBox(ipco, func(boxType string, body []byte) bool {
+		if boxType != "ispe" || len(body) < 12 {
+			return true
+		}
+		w := int(binary.BigEndian.Uint32(body[4:8]))
+		h := int(binary.BigEndian.Uint32(body[8:12]))
+		if w*h > width*height {
+			width, height = w, h
+		}
+		return true
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if width == 0 || height == 0 {
+		return 0, 0, errors.New("ispe box not found")
+	}
+	return width, height, nil
+}
+
+// heicOrientation は ipco 内の irot（反時計回りの回転角）を EXIF の Orientation に変換して返す。
+// 反転（imir）は幅と高さに影響しないため考慮しない
+func heicOrientation(data []byte) int {
+	meta, ok := findBox(data, "meta")
+	if !ok || len(meta) < 4 {
+		return 1
+	}
+	iprp, ok := findBox(meta[4:], "iprp")
+	if !ok {
+		return 1
+	}
+	ipco, ok := findBox(iprp, "ipco")
+	if !ok {
+		return 1
+	}
+	irot, ok := findBox(ipco, "irot")
+	if !ok || len(irot) < 1 {
+		return 1
+	}
+	switch irot[0] & 0x03 {
+	case 1: // 反時計回りに90度
+		return 8
+	case 2:
+		return 3
+	case 3: // 反時計回りに270度（時計回りに90度）
+		return 6
+	}
+	return 1
+}
+
+// findBox は data の直下から指定した種類のボックスを探し、その中身を返す
+func findBox(data []byte, want string) ([]byte, bool) {
+	var found []byte
+	err := eachBox(data, func(boxType string, body []byte) bool {
+		if boxType == want {
+			found = body
+			return false
+		}
+		return true
+	})
+	return found, err == nil && found != nil
+}
+
+// eachBox は data 直下のボックスを順に fn に渡す。fn が false を返すと終了する
+func eachBox(data []byte, fn func(boxType string, body []byte) bool) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return errors.New("truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		boxType := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			// 0 はファイル末尾までを表す
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return errors.New("truncated box header")
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return errors.New("invalid box size")
+		}
+		if !fn(boxType, data[header:size]) {
+			return nil
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// heicItem はメタデータを消去する対象のアイテム
+type heicItem struct {
+	id     uint32
+	isExif bool
+}
+
+// stripHEIC は Exif と XMP のアイテムを上書きして位置情報や端末情報を消去する。
+// アイテムの位置がずれないよう、ファイルの構造は変えずに同じ長さのデータで置き換える
+func stripHEIC(data []byte, opts NormalizeOptions) ([]byte, error) {
+	out := bytes.Clone(data)
+	meta, ok := findBox(out, "meta")
+	if !ok || len(meta) < 4 {
+		return nil, errors.New("meta box not found")
+	}
+	meta = meta[4:]
+
+	iinf, ok := findBox(meta, "iinf")
+	if !ok {
+		// アイテムが無ければメタデータも無い
+		return out, nil
+	}
+	items, err := heicMetadataItems(iinf)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return out, nil
+	}
+
+	iloc, ok := findBox(meta, "iloc")
+	if !ok {
+		return nil, errors.New("iloc box not found")
+	}
+	idat, _ := findBox(meta, "idat")
+	locations, err := heicItemLocations(iloc, out, idat)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		extents, ok := locations[item.id]
+		if !ok {
+			continue
+		}
+		if item.isExif {
+			scrubHEICExif(extents, opts)
+		} else {
+			// XMP は空白で埋める
+			for _, extent := range extents {
+				for i := range extent {
+					extent[i] = ' '
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// scrubHEICExif は Exif アイテムを撮影日時だけ（または空）の EXIF で置き換え、残りを 0 で埋める
+func scrubHEICExif(extents [][]byte, opts NormalizeOptions) {
+	var original []byte
+	for _, extent := range extents {
+		original = append(original, extent...)
+	}
+
+	// 先頭 4 バイトは TIFF ヘッダーまでのオフセット
+	var info exifInfo
+	if len(original) >= 4 {
+		offset := int(binary.BigEndian.Uint32(original))
+		if 4+offset <= len(original) {
+			info, _ = parseExif(original[4+offset:])
+		}
+	}
+
+	tiff := captureExif(info, opts)
+	if tiff == nil {
+		// エントリが 0 個の IFD0 だけの TIFF
+		tiff = []byte("MM\x00*\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00")
+	}
+	replacement := binary.BigEndian.AppendUint32(nil, uint32(len(exifHeader)))
+	replacement = append(replacement, exifHeader...)
+	replacement = append(replacement, tiff...)
+	if len(replacement) > len(original) {
+		replacement = nil
+	}
+
+	pos := 0
+	for _, extent := range extents {
+		for i := range extent {
+			if pos < len(replacement) {
+				extent[i] = replacement[pos]
+			} else {
+				extent[i] = 0
+			}
+			pos++
+		}
+	}
+}
+
+// heicMetadataItems は iinf ボックスから Exif と XMP のアイテムを探す
+func heicMetadataItems(iinf []byte) ([]heicItem, error) {
+	if len(iinf) < 6 {
+		return nil, errors.New("truncated iinf box")
+	}
+	entries := iinf[6:]
+	if iinf[0] != 0 {
+		if len(iinf) < 8 {
+			return nil, errors.New("truncated iinf box")
+		}
+		entries = iinf[8:]
+	}
+
+	var items []heicItem
+	err := eachBox(entries, func(boxType string, body []byte) bool {
+		// item_type を持つのはバージョン 2 以降の infe
+		if boxType != "infe" || len(body) < 4 || body[0] < 2 {
+			return true
+		}
+		pos := 4
+		var id uint32
+		if body[0] == 2 {
+			if len(body) < pos+2 {
+				return true
+			}
+			id = uint32(binary.BigEndian.Uint16(body[pos:]))
+			pos += 2
+		} else {
+			if len(body) < pos+4 {
+				return true
+			}
+			id = binary.BigEndian.Uint32(body[pos:])
+			pos += 4
+		}
+		// item_protection_index を読み飛ばす
+		pos += 2
+		if len(body) < pos+4 {
+			return true
+		}
+		itemType := string(body[pos : pos+4])
+		pos += 4
+
+		switch itemType {
+		case "Exif":
+			items = append(items, heicItem{id: id, isExif: true})
+		case "mime":
+			// item_name の後ろに content_type が続く
+			fields := bytes.SplitN(body[pos:], []byte{0}, 3)
+			if len(fields) >= 2 && string(fields[1]) == "application/rdf+xml" {
+				items = append(items, heicItem{id: id})
+			}
+		}
+		return true
+	})
+	return items, err
+}
+
+// heicItemLocations は iloc ボックスからアイテムごとのデータの位置を読み取り、file（または idat）の
+// 部分スライスとして返す
+func heicItemLocations(iloc []byte, file []byte, idat []byte) (map[uint32][][]byte, error) {
+	r := &boxReader{data: iloc}
+	version := r.readUint(1)
+	r.skip(3)
+	sizes := r.readUint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0x0F)
+	sizes = r.readUint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0x0F)
+	}
+	var itemCount uint64
+	if version < 2 {
+		itemCount = r.readUint(2)
+	} else {
+		itemCount = r.readUint(4)
+	}
+
+	locations := make(map[uint32][][]byte)
+	for i := uint64(0); i < itemCount && r.err == nil; i++ {
+		var id uint64
+		if version < 2 {
+			id = r.readUint(2)
+		} else {
+			id = r.readUint(4)
+		}
+		constructionMethod := uint64(0)
+		if version == 1 || version == 2 {
+			constructionMethod = r.readUint(2) & 0x0F
+		}
+		r.skip(2)
+		baseOffset := r.readUint(baseOffsetSize)
+		extentCount := r.readUint(2)
+
+		var source []byte
+		switch constructionMethod {
+		case 0:
+			source = file
+		case 1:
+			source = idat
+		default:
+			return nil, fmt.Errorf("unsupported iloc construction method: %d", constructionMethod)
+		}
+
+		for j := uint64(0); j < extentCount && r.err == nil; j++ {
+			if indexSize > 0 {
+				r.skip(indexSize)
+			}
+			offset := r.readUint(offsetSize)
+			length := r.readUint(lengthSize)
+			// 足し算が桁あふれしないよう、残りの長さと比べる
+			size := uint64(len(source))
+			if baseOffset > size || offset > size-baseOffset {
+				return nil, errors.New("item extent out of range")
+			}
+			start := baseOffset + offset
+			if length == 0 {
+				// 0 はデータの末尾までを表す
+				length = size - start
+			}
+			if length > size-start {
+				return nil, errors.New("item extent out of range")
+			}
+			locations[uint32(id)] = append(locations[uint32(id)], source[start:start+length])
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return locations, nil
+}
+
+// boxReader はボックスの中身をビッグエンディアンで順に読む。範囲外を読むと err を設定する
+type boxReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *boxReader) readUint(size int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos+size > len(r.data) {
+		r.err = errors.New("truncated box")
+		return 0
+	}
+	var v uint64
+	for _, b := range r.data[r.pos : r.pos+size] {
+		v = v<<8 | uint64(b)
+	}
+	r.pos += size
+	return v
+}
+
+func (r *boxReader) skip(size int) {
+	if r.err != nil {
+		return
+	}
+	if r.pos+size > len(r.data) {
+		r.err = errors.New("truncated box")
+		return
+	}
+	r.pos += size
+}
@@ -0,0 +1,361 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestStripHEIC(t *testing.T) {
+	data := buildTestHEIC(buildTestExif(binary.BigEndian, 1), 0)
+	for _, keep := range []bool{false, true} {
+		out, err := stripHEIC(data, NormalizeOptions{KeepCaptureTime: keep})
+		if err != nil {
+			t.Fatalf("keep=%v: %v", keep, err)
+		}
+		// アイテムの位置がずれないよう、長さと XMP 以外の構造は変えない
+		if len(out) != len(data) {
+			t.Fatalf("keep=%v: length = %d, want %d", keep, len(out), len(data))
+		}
+		// Exif アイテムの直後に XMP のアイテムがある
+		exifAt := heicExifItemAt(data)
+		xmpAt := bytes.Index(data, testXMP)
+		if !bytes.Equal(out[:exifAt], data[:exifAt]) || !bytes.Equal(out[xmpAt+len(testXMP):], data[xmpAt+len(testXMP):]) {
+			t.Errorf("keep=%v: data outside the metadata items changed", keep)
+		}
+		if bytes.Contains(out, []byte(testMake)) || bytes.Contains(out, []byte(testModel)) {
+			t.Errorf("keep=%v: device name remains", keep)
+		}
+		if got := out[xmpAt : xmpAt+len(testXMP)]; !bytes.Equal(got, bytes.Repeat([]byte(" "), len(testXMP))) {
+			t.Errorf("keep=%v: XMP = %q, want spaces", keep, got)
+		}
+		if w, h, err := heicDimensions(out); err != nil || w != 32 || h != 16 {
+			t.Errorf("keep=%v: dimensions = %dx%d, %v", keep, w, h, err)
+		}
+	}
+}
+
+func TestStripHEICMalformed(t *testing.T) {
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00"))
+	iinf := isoBox("iinf", []byte{0, 0, 0, 0, 0, 1}, infeBox(1, "Exif", ""))
+	heic := func(children ...[]byte) []byte {
+		return append(bytes.Clone(ftyp), isoBox("meta", append([][]byte{{0, 0, 0, 0}}, children...)...)...)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"no meta", ftyp, true},
+		{"meta without version", append(bytes.Clone(ftyp), isoBox("meta")...), true},
+		{"no items", heic(), false},
+		{"no metadata items", heic(isoBox("iinf", []byte{0, 0, 0, 0, 0, 1}, infeBox(1, "hvc1", "")), ilocBox()), false},
+		{"no iloc", heic(iinf), true},
+		{"item without location", heic(iinf, ilocBox()), false},
+		{"truncated iinf", heic(isoBox("iinf", []byte{0, 0, 0})), true},
+		{"truncated iloc", heic(iinf, isoBox("iloc", []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1, 0, 1})), true},
+		{"extent out of range", heic(iinf, ilocBox([3]uint32{1, 0xFFFFFF, 4})), true},
+		{"extent length out of range", heic(iinf, ilocBox([3]uint32{1, 0, 0xFFFFFF})), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := stripHEIC(tt.data, NormalizeOptions{KeepCaptureTime: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(out, tt.data) {
+				t.Error("data without metadata was changed")
+			}
+		})
+	}
+}
+
+func TestHEICItemLocations(t *testing.T) {
+	file := []byte("0123456789abcdefghij")
+	idat := []byte("IDAT-DATA")
+	u16 := func(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+	u32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+	u64 := func(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name    string
+		iloc    []byte
+		want    map[uint32][]string
+		wantErr bool
+	}{
+		{
+			name: "version 0",
+			iloc: join([]byte{0, 0, 0, 0, 0x44, 0x00}, u16(2),
+				u16(1), u16(0), u16(1), u32(2), u32(3),
+				u16(2), u16(0), u16(2), u32(10), u32(2), u32(15), u32(1)),
+			want: map[uint32][]string{1: {"234"}, 2: {"ab", "f"}},
+		},
+		{
+			name: "base offset",
+			iloc: join([]byte{0, 0, 0, 0, 0x44, 0x40}, u16(1),
+				u16(1), u16(0), u32(10), u16(1), u32(2), u32(3)),
+			want: map[uint32][]string{1: {"cde"}},
+		},
+		{
+			name: "length 0 means the rest",
+			iloc: join([]byte{0, 0, 0, 0, 0x44, 0x00}, u16(1),
+				u16(1), u16(0), u16(1), u32(17), u32(0)),
+			want: map[uint32][]string{1: {"hij"}},
+		},
+		{
+			name: "version 1 from idat with index",
+			iloc: join([]byte{1, 0, 0, 0, 0x44, 0x04}, u16(1),
+				u16(7), u16(1), u16(0), u16(1), u32(0xFFFFFFFF), u32(5), u32(4)),
+			want: map[uint32][]string{7: {"DATA"}},
+		},
+		{
+			name: "version 2",
+			iloc: join([]byte{2, 0, 0, 0, 0x88, 0x00}, u32(1),
+				u32(70000), u16(0), u16(0), u16(1), u64(0), u64(4)),
+			want: map[uint32][]string{70000: {"0123"}},
+		},
+		{
+			name: "no offset and length fields",
+			iloc: join([]byte{0, 0, 0, 0, 0x00, 0x00}, u16(1),
+				u16(1), u16(0), u16(1)),
+			want: map[uint32][]string{1: {string(file)}},
+		},
+		{
+			name: "unsupported construction method",
+			iloc: join([]byte{1, 0, 0, 0, 0x44, 0x00}, u16(1),
+				u16(1), u16(2), u16(0), u16(1), u32(0), u32(1)),
+			wantErr: true,
+		},
+		{
+			name:    "truncated header",
+			iloc:    []byte{0, 0, 0, 0, 0x44},
+			wantErr: true,
+		},
+		{
+			name: "truncated item",
+			iloc: join([]byte{0, 0, 0, 0, 0x44, 0x00}, u16(2),
+				u16(1), u16(0), u16(1), u32(0), u32(1), u16(2)),
+			wantErr: true,
+		},
+		{
+			name: "truncated extent",
+			iloc: join([]byte{0, 0, 0, 0, 0x44, 0x00}, u16(1),
+				u16(1), u16(0), u16(3), u32(0), u32(1)),
+			wantErr: true,
+		},
+		{
+			name: "offset out of range",
+			iloc: join([]byte{0, 0, 0, 0, 0x44, 0x00}, u16(1),
+				u16(1), u16(0), u16(1), u32(21), u32(0)),
+			wantErr: true,
+		},
+		{
+			name: "length out of range",
+			iloc: join([]byte{0, 0, 0, 0, 0x44, 0x00}, u16(1),
+				u16(1), u16(0), u16(1), u32(10), u32(11)),
+			wantErr: true,
+		},
+		{
+			name: "length overflows",
+			iloc: join([]byte{0, 0, 0, 0, 0x48, 0x00}, u16(1),
+				u16(1), u16(0), u16(1), u32(10), u64(0xFFFFFFFFFFFFFFFF)),
+			wantErr: true,
+		},
+		{
+			name: "base offset overflows",
+			iloc: join([]byte{0, 0, 0, 0, 0x48, 0x80}, u16(1),
+				u16(1), u16(0), u64(0xFFFFFFFFFFFFFFFF), u16(1), u32(2), u64(1)),
+			wantErr: true,
+		},
+		{
+			name: "huge item count",
+			iloc: join([]byte{2, 0, 0, 0, 0x44, 0x00}, u32(0xFFFFFFFF),
+				u32(1), u16(0), u16(1), u32(0), u32(1)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locations, err := heicItemLocations(tt.iloc, file, idat)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := make(map[uint32][]string)
+			for id, extents := range locations {
+				for _, e := range extents {
+					got[id] = append(got[id], string(e))
+				}
+			}
+			if !tt.wantErr && !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("locations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHEICMetadataItems(t *testing.T) {
+	infeV1 := isoBox("infe", []byte{1, 0, 0, 0, 0, 3, 0, 0, 'n', 'a', 'm', 'e', 0})
+	infeV3 := isoBox("infe", append([]byte{3, 0, 0, 0, 0, 1, 0, 0, 0, 0}, "Exif\x00"...))
+	tests := []struct {
+		name    string
+		iinf    []byte
+		want    []heicItem
+		wantErr bool
+	}{
+		{
+			name: "exif and xmp",
+			iinf: bytes.Join([][]byte{{0, 0, 0, 0, 0, 3}, infeBox(1, "hvc1", ""), infeBox(2, "Exif", ""), infeBox(3, "mime", "application/rdf+xml")}, nil),
+			want: []heicItem{{id: 2, isExif: true}, {id: 3}},
+		},
+		{
+			name: "version 1 count",
+			iinf: bytes.Join([][]byte{{1, 0, 0, 0, 0, 0, 0, 1}, infeBox(4, "Exif", "")}, nil),
+			want: []heicItem{{id: 4, isExif: true}},
+		},
+		{
+			name: "32-bit item id",
+			iinf: bytes.Join([][]byte{{0, 0, 0, 0, 0, 1}, infeV3}, nil),
+			want: []heicItem{{id: 0x10000, isExif: true}},
+		},
+		{
+			name: "other mime and old infe are ignored",
+			iinf: bytes.Join([][]byte{{0, 0, 0, 0, 0, 2}, infeBox(1, "mime", "image/jpeg"), infeV1}, nil),
+		},
+		{
+			name: "truncated infe bodies are ignored",
+			iinf: bytes.Join([][]byte{{0, 0, 0, 0, 0, 3}, isoBox("infe", []byte{2, 0, 0}), isoBox("infe", []byte{2, 0, 0, 0, 0}), isoBox("infe", []byte{2, 0, 0, 0, 0, 1, 0, 0, 'E'})}, nil),
+		},
+		{name: "truncated header", iinf: []byte{0, 0, 0, 0, 0}, wantErr: true},
+		{name: "truncated version 1 header", iinf: []byte{1, 0, 0, 0, 0, 0, 0}, wantErr: true},
+		{name: "truncated box", iinf: append([]byte{0, 0, 0, 0, 0, 1}, isoBox("infe", []byte{2, 0, 0, 0})[:6]...), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := heicMetadataItems(tt.iinf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("items = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrubHEICExif(t *testing.T) {
+	item := binary.BigEndian.AppendUint32(nil, uint32(len(exifHeader)))
+	item = append(item, exifHeader...)
+	item = append(item, buildTestExif(binary.LittleEndian, 6)...)
+
+	tests := []struct {
+		name        string
+		item        []byte
+		split       int
+		keep        bool
+		wantCapture bool
+		wantZeroed  bool
+	}{
+		{name: "remove", item: item, split: len(item)},
+		{name: "keep capture time", item: item, split: len(item), keep: true, wantCapture: true},
+		{name: "keep capture time across extents", item: item, split: 20, keep: true, wantCapture: true},
+		{name: "offset out of range", item: append([]byte{0xFF, 0xFF, 0xFF, 0xFF}, item[4:]...), split: 10, keep: true},
+		{name: "too short for the replacement", item: item[:12], split: 5, keep: true, wantZeroed: true},
+		{name: "shorter than the offset", item: item[:3], split: 1, wantZeroed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Clone(tt.item)
+			scrubHEICExif([][]byte{data[:tt.split], data[tt.split:]}, NormalizeOptions{KeepCaptureTime: tt.keep})
+
+			if len(data) != len(tt.item) {
+				t.Fatalf("length = %d, want %d", len(data), len(tt.item))
+			}
+			if tt.wantZeroed {
+				if !bytes.Equal(data, make([]byte, len(data))) {
+					t.Errorf("item = %x, want zeros", data)
+				}
+				return
+			}
+			offset := binary.BigEndian.Uint32(data)
+			info, err := parseExif(data[4+offset:])
+			if err != nil {
+				t.Fatalf("replaced EXIF is invalid: %v", err)
+			}
+			if info.Orientation != 0 || info.hasCaptureTime() != tt.wantCapture {
+				t.Errorf("replaced EXIF = %+v, want capture time %v", info, tt.wantCapture)
+			}
+			if bytes.Contains(data, []byte(testModel)) {
+				t.Error("device name remains")
+			}
+		})
+	}
+}
+
+func TestHEICDimensions(t *testing.T) {
+	thumbnail := isoBox("ispe", []byte{0, 0, 0, 0, 0, 0, 0, 8, 0, 0, 0, 4})
+	large := isoBox("ispe", []byte{0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 192})
+	heic := func(ipco ...[]byte) []byte {
+		return isoBox("meta", []byte{0, 0, 0, 0}, isoBox("iprp", isoBox("ipco", ipco...)))
+	}
+	tests := []struct {
+		name         string
+		data         []byte
+		wantW, wantH int
+		wantErr      bool
+	}{
+		{name: "largest", data: heic(thumbnail, large, isoBox("ispe", []byte{0, 0})), wantW: 256, wantH: 192},
+		{name: "no ispe", data: heic(isoBox("irot", []byte{1})), wantErr: true},
+		{name: "no ipco", data: isoBox("meta", []byte{0, 0, 0, 0}, isoBox("iprp")), wantErr: true},
+		{name: "no iprp", data: isoBox("meta", []byte{0, 0, 0, 0}), wantErr: true},
+		{name: "no meta", data: isoBox("ftyp"), wantErr: true},
+		{name: "truncated ipco", data: heic(thumbnail[:10]), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, err := heicDimensions(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("dimensions = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestEachBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr bool
+	}{
+		{name: "boxes", data: append(isoBox("ftyp", []byte("heic")), isoBox("free")...), want: []string{"ftyp", "free"}},
+		{name: "size 0 runs to the end", data: []byte{0, 0, 0, 0, 'm', 'd', 'a', 't', 1, 2, 3}, want: []string{"mdat"}},
+		{name: "64-bit size", data: []byte{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0, 0, 0, 0, 0, 0, 0, 17, 'x'}, want: []string{"free"}},
+		{name: "truncated header", data: []byte{0, 0, 0, 8, 'f'}, wantErr: true},
+		{name: "truncated 64-bit size", data: []byte{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0, 0}, wantErr: true},
+		{name: "size smaller than header", data: []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}, wantErr: true},
+		{name: "64-bit size smaller than header", data: []byte{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0, 0, 0, 0, 0, 0, 0, 8}, wantErr: true},
+		{name: "size beyond the end", data: []byte{0, 0, 0, 9, 'f', 'r', 'e', 'e'}, wantErr: true},
+		{name: "huge 64-bit size", data: []byte{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := eachBox(tt.data, func(boxType string, body []byte) bool {
+				got = append(got, boxType)
+				return true
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("boxes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
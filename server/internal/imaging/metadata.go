@@ -0,0 +1,460 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/webp"
+)
+
+// reencodeJPEGQuality は向きを直すために JPEG を再エンコードするときの品質
+const reencodeJPEGQuality = 92
+
+var errMalformedJPEG = errors.New("jpeg: malformed segment")
+
+// NormalizeOptions は Normalize の設定
+type NormalizeOptions struct {
+	// KeepCaptureTime が true なら撮影日時だけを EXIF に残す
+	KeepCaptureTime bool
+}
+
+// Normalize は EXIF の Orientation に従って画素を回転させて向きを揃え、位置情報や端末情報などの
+// メタデータを取り除いた画像を返す。回転が不要な場合は再エンコードせずにメタデータだけを取り除く。
+// カラープロファイルは残す。WebP を回転した場合は JPEG（透過があれば PNG）に変換するため、
+// 変換後の形式も返す
+func Normalize(data []byte, opts NormalizeOptions) ([]byte, Format, error) {
+	format, ok := detectFormat(data)
+	if !ok {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	var out []byte
+	var err error
+	switch format {
+	case FormatJPEG:
+		out, err = normalizeJPEG(data, opts)
+	case FormatPNG:
+		out, err = normalizePNG(data, opts)
+	case FormatWebP:
+		out, format, err = normalizeWebP(data, opts)
+	case FormatHEIC:
+		// HEIC の向きは irot / imir プロパティで表され、デコーダが適用するため画素は回転しない
+		out, err = stripHEIC(data, opts)
+	default:
+		return nil, "", ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to normalize %s image: %w", format, err)
+	}
+	return out, format, nil
+}
+
+// captureExif は KeepCaptureTime が有効で撮影日時がある場合に、撮影日時だけの EXIF を返す
+func captureExif(info exifInfo, opts NormalizeOptions) []byte {
+	if !opts.KeepCaptureTime || !info.hasCaptureTime() {
+		return nil
+	}
+	return buildCaptureExif(info)
+}
+
+func normalizeJPEG(data []byte, opts NormalizeOptions) ([]byte, error) {
+	segments, imageData, err := splitJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var info exifInfo
+	var kept, icc [][]byte
+	for _, seg := range segments {
+		marker, payload := seg[1], seg[4:]
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, exifHeader):
+			// 壊れた EXIF は向きが読めないだけなので無視して取り除く
+			if parsed, err := parseExif(payload); err == nil {
+				info = parsed
+			}
+		case marker == 0xE0 && bytes.HasPrefix(payload, []byte("JFIF\x00")),
+			marker == 0xEE && bytes.HasPrefix(payload, []byte("Adobe")):
+			kept = append(kept, seg)
+		case marker == 0xE2 && bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00")):
+			kept = append(kept, seg)
+			icc = append(icc, seg)
+		case marker >= 0xE0 && marker <= 0xEF, marker == 0xFE:
+			// その他の APPn（XMP・IPTC・MPF など）とコメントは取り除く
+		default:
+			kept = append(kept, seg)
+		}
+	}
+
+	var exifSegment [][]byte
+	if exif := captureExif(info, opts); exif != nil {
+		exifSegment = append(exifSegment, jpegSegment(0xE1, append(bytes.Clone(exifHeader), exif...)))
+	}
+
+	if info.Orientation > 1 {
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		// CMYK は RGB に変換して保存するため、元のカラープロファイルは使えない
+		if _, ok := img.(*image.CMYK); ok {
+			icc = nil
+		}
+		return encodeJPEG(applyOrientation(img, info.Orientation), append(icc, exifSegment...))
+	}
+
+	// JFIF の APP0 は先頭に置く必要があるので、EXIF はその後ろに入れる
+	insertAt := 0
+	if len(kept) > 0 && kept[0][1] == 0xE0 {
+		insertAt = 1
+	}
+	kept = append(kept[:insertAt], append(exifSegment, kept[insertAt:]...)...)
+
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8})
+	for _, seg := range kept {
+		out.Write(seg)
+	}
+	out.Write(imageData)
+	return out.Bytes(), nil
+}
+
+// splitJPEG は最初の SOS より前のセグメント（マーカーを含む）と、SOS から EOI までの画像データに分ける。
+// EOI の後ろに付加されたデータ（MPF の副画像など）は捨てる
+func splitJPEG(data []byte) ([][]byte, []byte, error) {
+	var segments [][]byte
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return nil, nil, errMalformedJPEG
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xDA {
+			end := jpegImageEnd(data, pos)
+			return segments, data[pos:end], nil
+		}
+		if pos+4 > len(data) {
+			return nil, nil, errMalformedJPEG
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end < pos+4 || end > len(data) {
+			return nil, nil, errMalformedJPEG
+		}
+		segments = append(segments, data[pos:end])
+		pos = end
+	}
+}
+
+// jpegImageEnd は pos の SOS から読み進めて EOI の直後の位置を返す。EOI が無ければ末尾を返す
+func jpegImageEnd(data []byte, pos int) int {
+	for pos+4 <= len(data) {
+		marker := data[pos+1]
+		if marker == 0xD9 {
+			return pos + 2
+		}
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker != 0xDA {
+			continue
+		}
+		// SOS の後はエントロピー符号化データが続く。0xFF00 と RST マーカーはデータの一部
+		for pos+1 < len(data) {
+			if data[pos] == 0xFF && data[pos+1] != 0x00 && (data[pos+1] < 0xD0 || data[pos+1] > 0xD7) {
+				break
+			}
+			pos++
+		}
+	}
+	if pos+2 <= len(data) && data[pos] == 0xFF && data[pos+1] == 0xD9 {
+		return pos + 2
+	}
+	return len(data)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// jpegICCSegments はカラープロファイルを APP2 セグメントに分割する
+func jpegICCSegments(icc []byte) [][]byte {
+	const maxChunk = 65535 - 2 - 14
+	count := (len(icc) + maxChunk - 1) / maxChunk
+	var segments [][]byte
+	for i := 0; i < count; i++ {
+		chunk := icc[i*maxChunk : min((i+1)*maxChunk, len(icc))]
+		payload := append([]byte("ICC_PROFILE\x00"), byte(i+1), byte(count))
+		segments = append(segments, jpegSegment(0xE2, append(payload, chunk...)))
+	}
+	return segments
+}
+
+// encodeJPEG は画像を JPEG にエンコードし、SOI の直後に extra のセグメントを挿入する
+func encodeJPEG(img image.Image, extra [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: reencodeJPEGQuality}); err != nil {
+		return nil, err
+	}
+	encoded := buf.Bytes()
+
+	var out bytes.Buffer
+	out.Write(encoded[:2])
+	for _, seg := range extra {
+		out.Write(seg)
+	}
+	out.Write(encoded[2:])
+	return out.Bytes(), nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngColorChunks は再エンコード時にも引き継ぐ色空間のチャンク
+var pngColorChunks = map[string]bool{"iCCP": true, "sRGB": true, "gAMA": true, "cHRM": true}
+
+func normalizePNG(data []byte, opts NormalizeOptions) ([]byte, error) {
+	var info exifInfo
+	var kept, colors [][]byte
+	err := eachPNGChunk(data, func(chunkType string, payload, raw []byte) {
+		switch chunkType {
+		case "eXIf":
+			if parsed, err := parseExif(payload); err == nil {
+				info = parsed
+			}
+		case "tEXt", "zTXt", "iTXt", "tIME":
+			// テキスト（XMP を含む）と更新日時は取り除く
+		default:
+			kept = append(kept, raw)
+			if pngColorChunks[chunkType] {
+				colors = append(colors, raw)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var extra [][]byte
+	if exif := captureExif(info, opts); exif != nil {
+		extra = append(extra, pngChunk("eXIf", exif))
+	}
+
+	if info.Orientation > 1 {
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return encodePNG(applyOrientation(img, info.Orientation), append(colors, extra...))
+	}
+
+	// IHDR は必ず先頭のチャンクなので、その後ろに EXIF を入れる
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for i, raw := range kept {
+		out.Write(raw)
+		if i == 0 {
+			for _, chunk := range extra {
+				out.Write(chunk)
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// eachPNGChunk は PNG のチャンクを順に fn に渡す。raw は長さと CRC を含むチャンク全体
+func eachPNGChunk(data []byte, fn func(chunkType string, payload, raw []byte)) error {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return errors.New("png: invalid signature")
+	}
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return errors.New("png: truncated chunk")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return errors.New("png: truncated chunk")
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		fn(chunkType, data[pos+8:pos+8+length], data[pos:end])
+		pos = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return nil
+}
+
+func pngChunk(chunkType string, payload []byte) []byte {
+	chunk := make([]byte, 8, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// pngICCChunk はカラープロファイルから iCCP チャンクを作る
+func pngICCChunk(icc []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("ICC Profile\x00\x00")
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(icc); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return pngChunk("iCCP", buf.Bytes()), nil
+}
+
+// encodePNG は画像を PNG にエンコードし、IHDR の直後に extra のチャンクを挿入する
+func encodePNG(img image.Image, extra [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	encoded := buf.Bytes()
+
+	// シグネチャ（8バイト）と IHDR（25バイト）の後ろに挿入する
+	const ihdrEnd = 8 + 25
+	var out bytes.Buffer
+	out.Write(encoded[:ihdrEnd])
+	for _, chunk := range extra {
+		out.Write(chunk)
+	}
+	out.Write(encoded[ihdrEnd:])
+	return out.Bytes(), nil
+}
+
+const (
+	webpFlagExif = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func normalizeWebP(data []byte, opts NormalizeOptions) ([]byte, Format, error) {
+	var info exifInfo
+	var icc []byte
+	var chunks [][]byte
+	err := eachWebPChunk(data, func(fourCC string, payload, raw []byte) {
+		switch fourCC {
+		case "EXIF":
+			if parsed, err := parseExif(payload); err == nil {
+				info = parsed
+			}
+		case "XMP ":
+		default:
+			if fourCC == "ICCP" {
+				icc = payload
+			}
+			chunks = append(chunks, raw)
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	exif := captureExif(info, opts)
+
+	if info.Orientation > 1 {
+		// WebP のエンコーダが無いため、回転した画像は JPEG（透過があれば PNG）で保存する
+		img, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", err
+		}
+		oriented := applyOrientation(img, info.Orientation)
+		if oriented.Opaque() {
+			extra := jpegICCSegments(icc)
+			if exif != nil {
+				extra = append(extra, jpegSegment(0xE1, append(bytes.Clone(exifHeader), exif...)))
+			}
+			out, err := encodeJPEG(oriented, extra)
+			return out, FormatJPEG, err
+		}
+		var extra [][]byte
+		if icc != nil {
+			chunk, err := pngICCChunk(icc)
+			if err != nil {
+				return nil, "", err
+			}
+			extra = append(extra, chunk)
+		}
+		if exif != nil {
+			extra = append(extra, pngChunk("eXIf", exif))
+		}
+		out, err := encodePNG(oriented, extra)
+		return out, FormatPNG, err
+	}
+
+	// メタデータは拡張形式（VP8X）にしか含まれない
+	if len(chunks) == 0 || string(chunks[0][0:4]) != "VP8X" {
+		return data, FormatWebP, nil
+	}
+	// VP8X の中身はフラグを含む 10 バイト
+	if binary.LittleEndian.Uint32(chunks[0][4:8]) < 10 {
+		return nil, "", errors.New("webp: truncated VP8X chunk")
+	}
+
+	vp8x := bytes.Clone(chunks[0])
+	vp8x[8] &^= webpFlagExif | webpFlagXMP
+	if exif != nil {
+		vp8x[8] |= webpFlagExif
+		// EXIF チャンクは画像データの後ろに置く
+		chunks = append(chunks, webpChunk("EXIF", exif))
+	}
+	chunks[0] = vp8x
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range chunks {
+		body.Write(chunk)
+	}
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:], uint32(body.Len()))
+	return append(out, body.Bytes()...), FormatWebP, nil
+}
+
+// eachWebPChunk は RIFF のチャンクを順に fn に渡す。raw はヘッダーとパディングを含むチャンク全体
+func eachWebPChunk(data []byte, fn func(fourCC string, payload, raw []byte)) error {
+	if len(data) < 12 {
+		return errors.New("webp: truncated header")
+	}
+	end := min(len(data), 8+int(binary.LittleEndian.Uint32(data[4:8])))
+	pos := 12
+	for pos < end {
+		if pos+8 > end {
+			return errors.New("webp: truncated chunk")
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		payloadEnd := pos + 8 + size
+		if payloadEnd > end {
+			return errors.New("webp: truncated chunk")
+		}
+		chunkEnd := min(payloadEnd+size%2, end)
+		fn(string(data[pos:pos+4]), data[pos+8:payloadEnd], data[pos:chunkEnd])
+		pos = chunkEnd
+	}
+	return nil
+}
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	chunk := make([]byte, 8, 8+len(payload)+1)
+	copy(chunk, fourCC)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
@@ -0,0 +1,261 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// exifPayload は出力に含まれる EXIF を返す。HEIC は Exif アイテムの "Exif\0\0" から後ろを返す
+func exifPayload(t *testing.T, data []byte, format Format) ([]byte, bool) {
+	t.Helper()
+
+	var exif []byte
+	var err error
+	switch format {
+	case FormatJPEG:
+		var segments [][]byte
+		segments, _, err = splitJPEG(data)
+		for _, seg := range segments {
+			if seg[1] == 0xE1 && bytes.HasPrefix(seg[4:], exifHeader) {
+				exif = seg[4:]
+			}
+		}
+	case FormatPNG:
+		err = eachPNGChunk(data, func(chunkType string, payload, raw []byte) {
+			if chunkType == "eXIf" {
+				exif = payload
+			}
+		})
+	case FormatWebP:
+		err = eachWebPChunk(data, func(fourCC string, payload, raw []byte) {
+			if fourCC == "EXIF" {
+				exif = payload
+			}
+		})
+	case FormatHEIC:
+		if i := heicExifItemAt(data); i >= 0 {
+			exif = data[i+4:]
+		}
+	}
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	return exif, exif != nil
+}
+
+// tiffTags は IFD0 と、そこから指される Exif IFD と GPS IFD のタグを返す
+func tiffTags(t *testing.T, exif []byte) []uint16 {
+	t.Helper()
+
+	data := bytes.TrimPrefix(exif, exifHeader)
+	var order binary.ByteOrder = binary.BigEndian
+	if bytes.HasPrefix(data, []byte("II")) {
+		order = binary.LittleEndian
+	}
+	var tags []uint16
+	var pointers []uint32
+	err := eachIFDEntry(data, order, order.Uint32(data[4:8]), func(tag, typ uint16, count uint32, value []byte) {
+		tags = append(tags, tag)
+		if tag == tagExifIFDPointer || tag == tagGPSIFDPtr {
+			pointers = append(pointers, order.Uint32(value))
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to read IFD0: %v", err)
+	}
+	for _, p := range pointers {
+		err := eachIFDEntry(data, order, p, func(tag, typ uint16, count uint32, value []byte) {
+			tags = append(tags, tag)
+		})
+		if err != nil {
+			t.Fatalf("failed to read IFD at %d: %v", p, err)
+		}
+	}
+	return tags
+}
+
+func TestNormalizeRemovesMetadata(t *testing.T) {
+	exif := buildTestExif(binary.LittleEndian, 1)
+	fixtures := []struct {
+		name   string
+		format Format
+		data   []byte
+	}{
+		{"jpeg", FormatJPEG, buildTestJPEG(t, exif)},
+		{"jpeg big endian", FormatJPEG, buildTestJPEG(t, buildTestExif(binary.BigEndian, 1))},
+		{"jpeg rotated", FormatJPEG, buildTestJPEG(t, buildTestExif(binary.LittleEndian, 6))},
+		{"png", FormatPNG, buildTestPNG(t, exif)},
+		{"png rotated", FormatPNG, buildTestPNG(t, buildTestExif(binary.BigEndian, 8))},
+		{"webp", FormatWebP, buildTestWebP(exif)},
+		{"heic", FormatHEIC, buildTestHEIC(exif, 0)},
+	}
+	for _, fx := range fixtures {
+		for _, keep := range []bool{false, true} {
+			name := fx.name
+			if keep {
+				name += " keeping capture time"
+			}
+			t.Run(name, func(t *testing.T) {
+				out, format, err := Normalize(fx.data, NormalizeOptions{KeepCaptureTime: keep})
+				if err != nil {
+					t.Fatalf("Normalize: %v", err)
+				}
+				if format != fx.format {
+					t.Fatalf("format = %s, want %s", format, fx.format)
+				}
+				for _, s := range []string{testMake, testModel} {
+					if bytes.Contains(out, []byte(s)) {
+						t.Errorf("output still contains %q", s)
+					}
+				}
+
+				exif, ok := exifPayload(t, out, format)
+				if !ok {
+					if keep {
+						t.Fatal("capture time was removed")
+					}
+					return
+				}
+				info, err := parseExif(exif)
+				if err != nil {
+					t.Fatalf("output EXIF is invalid: %v", err)
+				}
+				tags := tiffTags(t, exif)
+				if keep {
+					if info.DateTimeOriginal != testCaptureTime || info.OffsetTimeOriginal != testCaptureTZ {
+						t.Errorf("capture time = %q %q, want %q %q", info.DateTimeOriginal, info.OffsetTimeOriginal, testCaptureTime, testCaptureTZ)
+					}
+					want := []uint16{tagExifIFDPointer, tagDateTimeOriginal, tagOffsetTimeOriginal}
+					if !slices.Equal(tags, want) {
+						t.Errorf("tags = %#x, want %#x", tags, want)
+					}
+					return
+				}
+				// HEIC は Exif アイテムを消せないので、空の EXIF が残る
+				if format != FormatHEIC {
+					t.Error("EXIF was not removed")
+				}
+				if info.hasCaptureTime() || len(tags) != 0 {
+					t.Errorf("EXIF still has tags %#x", tags)
+				}
+			})
+		}
+	}
+}
+
+func TestNormalizeKeepsColorProfile(t *testing.T) {
+	exif := buildTestExif(binary.LittleEndian, 1)
+	tests := []struct {
+		name    string
+		data    []byte
+		profile string
+	}{
+		{"jpeg", buildTestJPEG(t, exif), "ICC_PROFILE\x00\x01\x01test profile"},
+		{"jpeg rotated", buildTestJPEG(t, buildTestExif(binary.LittleEndian, 3)), "ICC_PROFILE\x00\x01\x01test profile"},
+		{"png", buildTestPNG(t, exif), "sRGB"},
+		{"png rotated", buildTestPNG(t, buildTestExif(binary.LittleEndian, 3)), "sRGB"},
+		{"webp", buildTestWebP(exif), "test profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _, err := Normalize(tt.data, NormalizeOptions{})
+			if err != nil {
+				t.Fatalf("Normalize: %v", err)
+			}
+			if !bytes.Contains(out, []byte(tt.profile)) {
+				t.Errorf("color profile %q was removed", tt.profile)
+			}
+		})
+	}
+}
+
+func TestNormalizeWebPFlags(t *testing.T) {
+	data := buildTestWebP(buildTestExif(binary.LittleEndian, 1))
+	for _, keep := range []bool{false, true} {
+		out, _, err := Normalize(data, NormalizeOptions{KeepCaptureTime: keep})
+		if err != nil {
+			t.Fatalf("Normalize: %v", err)
+		}
+		var flags byte
+		var fourCCs []string
+		if err := eachWebPChunk(out, func(fourCC string, payload, raw []byte) {
+			if fourCC == "VP8X" {
+				flags = payload[0]
+			}
+			fourCCs = append(fourCCs, fourCC)
+		}); err != nil {
+			t.Fatalf("output is invalid: %v", err)
+		}
+		if flags&webpFlagXMP != 0 || slices.Contains(fourCCs, "XMP ") {
+			t.Errorf("keep=%v: XMP remains (flags %#x, chunks %q)", keep, flags, fourCCs)
+		}
+		if hasExif := flags&webpFlagExif != 0; hasExif != keep || slices.Contains(fourCCs, "EXIF") != keep {
+			t.Errorf("keep=%v: EXIF flag %v, chunks %q", keep, hasExif, fourCCs)
+		}
+		if size := int(binary.LittleEndian.Uint32(out[4:8])); size != len(out)-8 {
+			t.Errorf("keep=%v: RIFF size = %d, want %d", keep, size, len(out)-8)
+		}
+	}
+}
+
+func TestNormalizeMalformed(t *testing.T) {
+	webpWithVP8X := func(vp8x []byte) []byte {
+		body := append([]byte("WEBP"), webpChunk("VP8X", vp8x)...)
+		return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"jpeg segment beyond the end", []byte("\xFF\xD8\xFF\xE1\x00\x10Exif\x00\x00")},
+		{"jpeg segment shorter than its length field", []byte("\xFF\xD8\xFF\xE1\x00\x01\xFF\xDA\x00\x02\xFF\xD9")},
+		{"jpeg without marker", []byte("\xFF\xD8\x00\x00\x00\x00")},
+		{"png truncated chunk", append(bytes.Clone(pngSignature), 0, 0, 0, 13, 'I', 'H', 'D', 'R')},
+		{"webp truncated chunk", webpWithVP8X(nil)[:18]},
+		{"webp VP8X without flags", webpWithVP8X(nil)},
+		{"webp VP8X too short", webpWithVP8X([]byte{webpFlagXMP, 0, 0})},
+		{"heic without meta", isoBox("ftyp", []byte("heic\x00\x00\x00\x00"))},
+		{"heic truncated box", append(isoBox("ftyp", []byte("heic\x00\x00\x00\x00")), 0, 0, 0, 9, 'm', 'e', 't', 'a')},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Normalize(tt.data, NormalizeOptions{KeepCaptureTime: true}); err == nil {
+				t.Error("Normalize succeeded on malformed input")
+			}
+		})
+	}
+}
+
+// TestNormalizeCorruptInput は途中で切れた画像や一部が壊れた画像でパニックしないことを確かめる
+func TestNormalizeCorruptInput(t *testing.T) {
+	fixtures := map[string][]byte{
+		"jpeg": buildTestJPEG(t, buildTestExif(binary.LittleEndian, 6)),
+		"png":  buildTestPNG(t, buildTestExif(binary.BigEndian, 6)),
+		"webp": buildTestWebP(buildTestExif(binary.LittleEndian, 1)),
+		"heic": buildTestHEIC(buildTestExif(binary.BigEndian, 1), 1),
+	}
+	for name, data := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			format, _ := detectFormat(data)
+			check := func(corrupt []byte) {
+				Validate(corrupt, Limits{MaxBytes: 1 << 20, MaxDimension: 1024})
+				Normalize(corrupt, NormalizeOptions{KeepCaptureTime: true})
+				if o := readOrientation(corrupt, format); o < 1 || o > 8 {
+					t.Fatalf("readOrientation = %d", o)
+				}
+			}
+			for n := range len(data) {
+				check(data[:n])
+			}
+			for i := range data {
+				for _, b := range []byte{0x00, 0x01, 0x7F, 0xFF} {
+					corrupt := bytes.Clone(data)
+					corrupt[i] = b
+					check(corrupt)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+)
+
+// readOrientation は画像の向きを EXIF の Orientation（1〜8）で返す。
+// 向きの情報が無い場合や読み取れない場合は 1 を返す
+func readOrientation(data []byte, format Format) int {
+	var exif []byte
+	switch format {
+	case FormatJPEG:
+		segments, _, err := splitJPEG(data)
+		if err != nil {
+			return 1
+		}
+		for _, seg := range segments {
+			if seg[1] == 0xE1 && bytes.HasPrefix(seg[4:], exifHeader) {
+				exif = seg[4:]
+				break
+			}
+		}
+	case FormatPNG:
+		_ = eachPNGChunk(data, func(chunkType string, payload, raw []byte) {
+			if chunkType == "eXIf" {
+				exif = payload
+			}
+		})
+	case FormatWebP:
+		_ = eachWebPChunk(data, func(fourCC string, payload, raw []byte) {
+			if fourCC == "EXIF" {
+				exif = payload
+			}
+		})
+	case FormatHEIC:
+		return heicOrientation(data)
+	}
+	if exif == nil {
+		return 1
+	}
+	info, err := parseExif(exif)
+	if err != nil || info.Orientation < 1 || info.Orientation > 8 {
+		return 1
+	}
+	return info.Orientation
+}
+
+// ToNRGBA は画像を原点から始まる *image.NRGBA に変換する
+func ToNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	if n, ok := img.(*image.NRGBA); ok && b.Min == (image.Point{}) {
+		return n
+	}
+	rect := image.Rect(0, 0, b.Dx(), b.Dy())
+	if _, ok := img.(*image.YCbCr); ok {
+		// JPEG は不透明なので乗算済みの RGBA と値が変わらない。draw の高速パスを使う
+		rgba := image.NewRGBA(rect)
+		draw.Draw(rgba, rect, img, b.Min, draw.Src)
+		return &image.NRGBA{Pix: rgba.Pix, Stride: rgba.Stride, Rect: rect}
+	}
+	n := image.NewNRGBA(rect)
+	draw.Draw(n, rect, img, b.Min, draw.Src)
+	return n
+}
+
+// applyOrientation は EXIF の Orientation（1〜8）に従って画像を回転・反転し、
+// 表示される向きに揃えた画像を返す
+func applyOrientation(img image.Image, orientation int) *image.NRGBA {
+	src := ToNRGBA(img)
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 左右反転
+				dx, dy = w-1-x, y
+			case 3: // 180度回転
+				dx, dy = w-1-x, h-1-y
+			case 4: // 上下反転
+				dx, dy = x, h-1-y
+			case 5: // 左上と右下を結ぶ対角線で反転
+				dx, dy = y, x
+			case 6: // 時計回りに90度回転
+				dx, dy = h-1-y, x
+			case 7: // 右上と左下を結ぶ対角線で反転
+				dx, dy = h-1-y, w-1-x
+			case 8: // 反時計回りに90度回転
+				dx, dy = y, w-1-x
+			}
+			si := y*src.Stride + x*4
+			di := dy*dst.Stride + dx*4
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
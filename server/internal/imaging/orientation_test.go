@@ -0,0 +1,165 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// orientedQuadrants は quadrantImage を各 Orientation で表示した時の、左上・右上・左下・右下の色の番号
+var orientedQuadrants = map[int][4]int{
+	1: {0, 1, 2, 3},
+	2: {1, 0, 3, 2},
+	3: {3, 2, 1, 0},
+	4: {2, 3, 0, 1},
+	5: {0, 2, 1, 3},
+	6: {2, 0, 3, 1},
+	7: {3, 1, 2, 0},
+	8: {1, 3, 0, 2},
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// 3x2 の画像の画素に a〜f の名前を付ける
+	//   a b c
+	//   d e f
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i, name := range "abcdef" {
+		src.SetNRGBA(i%3, i/3, color.NRGBA{R: uint8(name), A: 255})
+	}
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{0, []string{"abc", "def"}},
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+		{9, []string{"abc", "def"}},
+	}
+	for _, tt := range tests {
+		dst := applyOrientation(src, tt.orientation)
+		var got []string
+		for y := 0; y < dst.Rect.Dy(); y++ {
+			var row []byte
+			for x := 0; x < dst.Rect.Dx(); x++ {
+				row = append(row, dst.NRGBAAt(x, y).R)
+			}
+			got = append(got, string(row))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("orientation %d: got %q, want %q", tt.orientation, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("orientation %d: got %q, want %q", tt.orientation, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestApplyOrientationSubImage(t *testing.T) {
+	// 原点から始まらない画像も同じ向きになる
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.NRGBA{A: 255})
+		}
+	}
+	sub := img.SubImage(image.Rect(16, 8, 48, 24)).(*image.NRGBA)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			sub.SetNRGBA(16+x, 8+y, quadrantColors[y/8*2+x/16])
+		}
+	}
+	for orientation, want := range orientedQuadrants {
+		if got := quadrants(applyOrientation(sub, orientation)); got != want {
+			t.Errorf("orientation %d: quadrants = %v, want %v", orientation, got, want)
+		}
+	}
+}
+
+func TestNormalizeOrientation(t *testing.T) {
+	formats := []struct {
+		name   string
+		build  func(exif []byte) []byte
+		decode func([]byte) (image.Image, error)
+	}{
+		{"jpeg", func(exif []byte) []byte { return buildTestJPEG(t, exif) }, func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }},
+		{"png", func(exif []byte) []byte { return buildTestPNG(t, exif) }, func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }},
+	}
+	for _, f := range formats {
+		for orientation := 1; orientation <= 8; orientation++ {
+			data := f.build(buildTestExif(binary.LittleEndian, orientation))
+			out, _, err := Normalize(data, NormalizeOptions{KeepCaptureTime: true})
+			if err != nil {
+				t.Fatalf("%s orientation %d: Normalize: %v", f.name, orientation, err)
+			}
+			img, err := f.decode(out)
+			if err != nil {
+				t.Fatalf("%s orientation %d: decode: %v", f.name, orientation, err)
+			}
+
+			wantW, wantH := 32, 16
+			if orientation >= 5 {
+				wantW, wantH = 16, 32
+			}
+			if b := img.Bounds(); b.Dx() != wantW || b.Dy() != wantH {
+				t.Errorf("%s orientation %d: size = %dx%d, want %dx%d", f.name, orientation, b.Dx(), b.Dy(), wantW, wantH)
+			}
+			if got := quadrants(img); got != orientedQuadrants[orientation] {
+				t.Errorf("%s orientation %d: quadrants = %v, want %v", f.name, orientation, got, orientedQuadrants[orientation])
+			}
+			// 向きを揃えた後は Orientation を残さない
+			format, _ := detectFormat(out)
+			if o := readOrientation(out, format); o != 1 {
+				t.Errorf("%s orientation %d: output orientation = %d", f.name, orientation, o)
+			}
+		}
+	}
+}
+
+func TestReadOrientation(t *testing.T) {
+	webpWithExif := func(exif []byte) []byte { return buildTestWebP(exif) }
+	tests := []struct {
+		name   string
+		data   []byte
+		format Format
+		want   int
+	}{
+		{"jpeg", buildTestJPEG(t, buildTestExif(binary.LittleEndian, 6)), FormatJPEG, 6},
+		{"jpeg big endian", buildTestJPEG(t, buildTestExif(binary.BigEndian, 8)), FormatJPEG, 8},
+		{"jpeg without orientation", buildTestJPEG(t, buildTestExif(binary.LittleEndian, 0)), FormatJPEG, 1},
+		{"jpeg without exif", buildTestJPEG(t, nil), FormatJPEG, 1},
+		{"jpeg with invalid orientation", buildTestJPEG(t, buildTestExif(binary.LittleEndian, 9)), FormatJPEG, 1},
+		{"jpeg with broken exif", buildTestJPEG(t, []byte("MM\x00*\x00\x00\xFF\xFF")), FormatJPEG, 1},
+		{"jpeg truncated segment", []byte("\xFF\xD8\xFF\xE1\x00\x20Exif\x00\x00MM"), FormatJPEG, 1},
+		{"jpeg segment without payload", []byte("\xFF\xD8\xFF\xE1\x00\x02\xFF\xDA\x00\x02\xFF\xD9"), FormatJPEG, 1},
+		{"png", buildTestPNG(t, buildTestExif(binary.BigEndian, 3)), FormatPNG, 3},
+		{"png without exif", buildTestPNG(t, nil), FormatPNG, 1},
+		{"webp", webpWithExif(buildTestExif(binary.LittleEndian, 5)), FormatWebP, 5},
+		{"webp without exif", webpWithExif(nil), FormatWebP, 1},
+		{"heic rotated 90 counterclockwise", buildTestHEIC(nil, 1), FormatHEIC, 8},
+		{"heic rotated 180", buildTestHEIC(nil, 2), FormatHEIC, 3},
+		{"heic rotated 270 counterclockwise", buildTestHEIC(nil, 3), FormatHEIC, 6},
+		{"heic not rotated", buildTestHEIC(nil, 0), FormatHEIC, 1},
+		{"heic without meta", isoBox("ftyp", []byte("heic\x00\x00\x00\x00")), FormatHEIC, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readOrientation(tt.data, tt.format); got != tt.want {
+				t.Errorf("readOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
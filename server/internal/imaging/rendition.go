@@ -0,0 +1,52 @@
+package imaging
+
+import (
+	"image"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Rendition は配信用に書き出す画像のサイズ
+type Rendition struct {
+	Name   string
+	Width  int
+	Height int
+	// Pad が true なら画像全体が収まるように拡大・縮小し、余白を透明にして Width x Height にする。
+	// false なら Width x Height に収まるように縮小するだけで、拡大はしない
+	Pad bool
+}
+
+// Renditions は加工済み画像から作るサイズの一覧
+var Renditions = []Rendition{
+	{Name: "thumbnail", Width: 320, Height: 320},
+	// Instagram の正方形・縦長の投稿とストーリー
+	{Name: "square", Width: 1080, Height: 1080, Pad: true},
+	{Name: "portrait", Width: 1080, Height: 1350, Pad: true},
+	{Name: "story", Width: 1080, Height: 1920, Pad: true},
+}
+
+// Render は画像をこのサイズに合わせて書き出す
+func (r Rendition) Render(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	if !r.Pad {
+		width, height := b.Dx(), b.Dy()
+		if width > r.Width || height > r.Height {
+			width, height = fitInto(width, height, r.Width, r.Height)
+		}
+		return Resize(img, width, height)
+	}
+
+	// 中央に配置し、周りは透明のままにする
+	width, height := fitInto(b.Dx(), b.Dy(), r.Width, r.Height)
+	dst := image.NewNRGBA(image.Rect(0, 0, r.Width, r.Height))
+	x := (r.Width - width) / 2
+	y := (r.Height - height) / 2
+	xdraw.CatmullRom.Scale(dst, image.Rect(x, y, x+width, y+height), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// fitInto は縦横比を保ったまま maxWidth x maxHeight にちょうど収まるサイズを返す
+func fitInto(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := min(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	return max(1, min(maxWidth, int(float64(width)*scale+0.5))), max(1, min(maxHeight, int(float64(height)*scale+0.5)))
+}
@@ -0,0 +1,85 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Decode は JPEG / PNG / WebP の画像をデコードする。HEIC などデコーダの無い形式は ErrUnsupportedFormat を返す
+func Decode(data []byte) (image.Image, Format, error) {
+	format, ok := detectFormat(data)
+	if !ok {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	var img image.Image
+	var err error
+	switch format {
+	case FormatJPEG:
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case FormatPNG:
+		img, err = png.Decode(bytes.NewReader(data))
+	case FormatWebP:
+		img, err = webp.Decode(bytes.NewReader(data))
+	default:
+		return nil, format, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, format, err
+	}
+	return img, format, nil
+}
+
+// Encode は画像を format でエンコードする。WebP はエンコーダが無いため JPEG（透過があれば PNG）にする
+func Encode(img image.Image, format Format) ([]byte, Format, error) {
+	switch format {
+	case FormatPNG:
+		out, err := encodePNG(img, nil)
+		return out, FormatPNG, err
+	case FormatWebP:
+		if !isOpaque(img) {
+			out, err := encodePNG(img, nil)
+			return out, FormatPNG, err
+		}
+	}
+	out, err := encodeJPEG(img, nil)
+	return out, FormatJPEG, err
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// FitWithin は長辺が maxEdge 以下になるよう縦横比を保って縮小したサイズを返す。
+// すでに収まっている場合は元のサイズを返す
+func FitWithin(width, height, maxEdge int) (int, int) {
+	longest := max(width, height)
+	if maxEdge <= 0 || longest <= maxEdge {
+		return width, height
+	}
+	scale := float64(maxEdge) / float64(longest)
+	return max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+}
+
+// Resize は画像を width x height に拡大・縮小する。縮小でも折り返しが出にくい Catmull-Rom を使う
+func Resize(img image.Image, width, height int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	return dst
+}
+
+// ResizeMask はマスク画像をグレースケールのまま width x height に拡大・縮小する。
+// 境界がなめらかになるよう双線形補間を使う
+func ResizeMask(mask image.Image, width, height int) *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, width, height))
+	xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), mask, mask.Bounds(), xdraw.Src, nil)
+	return dst
+}
@@ -0,0 +1,201 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strconv"
+
+	"golang.org/x/image/webp"
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatWebP Format = "webp"
+	FormatHEIC Format = "heic"
+	FormatGIF  Format = "gif"
+)
+
+var contentTypes = map[Format]string{
+	FormatJPEG: "image/jpeg",
+	FormatPNG:  "image/png",
+	FormatWebP: "image/webp",
+	FormatHEIC: "image/heic",
+	FormatGIF:  "image/gif",
+}
+
+// ContentType は形式に対応する MIME タイプを返す
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+var (
+	ErrTooLarge           = errors.New("image exceeds the maximum file size")
+	ErrDimensionsTooLarge = errors.New("image exceeds the maximum dimensions")
+	ErrUnsupportedFormat  = errors.New("unsupported image format")
+	ErrAnimated           = errors.New("animated images are not supported")
+	ErrCorrupt            = errors.New("image could not be decoded")
+)
+
+const (
+	defaultMaxBytes     = 20 << 20
+	defaultMaxDimension = 8192
+)
+
+// Limits はアップロードを受け付ける画像の上限
+type Limits struct {
+	MaxBytes int64
+	// MaxDimension は幅・高さそれぞれの上限（ピクセル）
+	MaxDimension int
+}
+
+// LimitsFromEnv は UPLOAD_MAX_BYTES / UPLOAD_MAX_DIMENSION から上限を読み込む
+func LimitsFromEnv() (Limits, error) {
+	limits := Limits{MaxBytes: defaultMaxBytes, MaxDimension: defaultMaxDimension}
+	if raw := os.Getenv("UPLOAD_MAX_BYTES"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v <= 0 {
+			return Limits{}, fmt.Errorf("invalid UPLOAD_MAX_BYTES: %q", raw)
+		}
+		limits.MaxBytes = v
+	}
+	if raw := os.Getenv("UPLOAD_MAX_DIMENSION"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			return Limits{}, fmt.Errorf("invalid UPLOAD_MAX_DIMENSION: %q", raw)
+		}
+		limits.MaxDimension = v
+	}
+	return limits, nil
+}
+
+// Info は検証済みの画像の情報
+type Info struct {
+	Format Format
+	// Width と Height は保存されている画素の幅と高さ（向きを揃える前）
+	Width  int
+	Height int
+	// Orientation は EXIF の Orientation（1〜8）。HEIC は irot を同じ値に変換する
+	Orientation int
+}
+
+// OrientedSize は向きを揃えた後（ブラウザで表示される向き）の幅と高さを返す
+func (i Info) OrientedSize() (int, int) {
+	if i.Orientation >= 5 {
+		return i.Height, i.Width
+	}
+	return i.Width, i.Height
+}
+
+// Validate はファイルの中身から画像の形式を判定し、JPEG / PNG / WebP として
+// 読み込めること、サイズとピクセル数が上限以内であることを検証する。
+// クライアントが申告した Content-Type は使わない
+func Validate(data []byte, limits Limits) (Info, error) {
+	if int64(len(data)) > limits.MaxBytes {
+		return Info{}, ErrTooLarge
+	}
+
+	format, ok := detectFormat(data)
+	if !ok {
+		return Info{}, ErrUnsupportedFormat
+	}
+
+	var info Info
+	var err error
+	switch format {
+	case FormatJPEG, FormatPNG:
+		info, err = validateDecodable(data, format, limits, func() error {
+			_, _, err := image.Decode(bytes.NewReader(data))
+			return err
+		})
+	case FormatWebP:
+		if isAnimatedWebP(data) {
+			return Info{}, ErrAnimated
+		}
+		info, err = validateDecodable(data, format, limits, func() error {
+			_, err := webp.Decode(bytes.NewReader(data))
+			return err
+		})
+	case FormatHEIC:
+		// HEIC はデコーダが無く、縮小・抽出・合成のいずれもできないため受け付けない
+		return Info{}, ErrUnsupportedFormat
+	case FormatGIF:
+		g, gerr := gif.DecodeAll(bytes.NewReader(data))
+		if gerr != nil {
+			return Info{}, fmt.Errorf("%w: %v", ErrCorrupt, gerr)
+		}
+		if len(g.Image) > 1 {
+			return Info{}, ErrAnimated
+		}
+		return Info{}, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	info.Orientation = readOrientation(data, format)
+	return info, nil
+}
+
+// validateDecodable はヘッダーからサイズを確認してから、画像全体をデコードできるか確認する。
+// 巨大な画像を展開しないよう、サイズの確認を先に行う
+func validateDecodable(data []byte, format Format, limits Limits, decode func() error) (Info, error) {
+	var cfg image.Config
+	var err error
+	if format == FormatWebP {
+		cfg, err = webp.DecodeConfig(bytes.NewReader(data))
+	} else {
+		cfg, _, err = image.DecodeConfig(bytes.NewReader(data))
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	info := Info{Format: format, Width: cfg.Width, Height: cfg.Height}
+	if err := checkDimensions(info, limits); err != nil {
+		return Info{}, err
+	}
+	if err := decode(); err != nil {
+		return Info{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return info, nil
+}
+
+func checkDimensions(info Info, limits Limits) error {
+	if info.Width <= 0 || info.Height <= 0 {
+		return fmt.Errorf("%w: invalid dimensions %dx%d", ErrCorrupt, info.Width, info.Height)
+	}
+	if info.Width > limits.MaxDimension || info.Height > limits.MaxDimension {
+		return fmt.Errorf("%w: %dx%d", ErrDimensionsTooLarge, info.Width, info.Height)
+	}
+	return nil
+}
+
+// detectFormat は先頭のマジックナンバーから画像形式を判定する
+func detectFormat(data []byte) (Format, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8\xFF")):
+		return FormatJPEG, true
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, true
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FormatWebP, true
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF, true
+	case isHEIC(data):
+		return FormatHEIC, true
+	}
+	return "", false
+}
+
+// isAnimatedWebP は拡張形式（VP8X）のアニメーションフラグを確認する
+func isAnimatedWebP(data []byte) bool {
+	return len(data) >= 21 && string(data[12:16]) == "VP8X" && data[20]&0x02 != 0
+}
@@ -0,0 +1,48 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	limits := Limits{MaxBytes: 1 << 20, MaxDimension: 1024}
+	tests := []struct {
+		name    string
+		data    []byte
+		limits  Limits
+		want    Info
+		wantErr error
+	}{
+		{"jpeg", buildTestJPEG(t, nil), limits, Info{Format: FormatJPEG, Width: 32, Height: 16, Orientation: 1}, nil},
+		{"jpeg rotated", buildTestJPEG(t, buildTestExif(binary.LittleEndian, 6)), limits, Info{Format: FormatJPEG, Width: 32, Height: 16, Orientation: 6}, nil},
+		{"png", buildTestPNG(t, nil), limits, Info{Format: FormatPNG, Width: 32, Height: 16, Orientation: 1}, nil},
+		{"too large", buildTestPNG(t, nil), Limits{MaxBytes: 16, MaxDimension: 1024}, Info{}, ErrTooLarge},
+		{"dimensions too large", buildTestPNG(t, nil), Limits{MaxBytes: 1 << 20, MaxDimension: 16}, Info{}, ErrDimensionsTooLarge},
+		{"broken webp", buildTestWebP(nil), limits, Info{}, ErrCorrupt},
+		// HEIC は形式として判定できても処理できないので受け付けない
+		{"heic", buildTestHEIC(nil, 0), limits, Info{}, ErrUnsupportedFormat},
+		{"gif", gifData.Bytes(), limits, Info{}, ErrUnsupportedFormat},
+		{"unknown", []byte("not an image"), limits, Info{}, ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Validate(tt.data, tt.limits)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Validate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
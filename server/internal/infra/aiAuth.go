@@ -0,0 +1,218 @@
+package infra
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// aiAuthenticator はAIサービスへのリクエストに付ける認証
+type aiAuthenticator interface {
+	// TLSConfig はクライアント証明書などの TLS の設定を返す。nil なら既定の設定を使う
+	TLSConfig() *tls.Config
+	// TokenSource は Authorization ヘッダーに付けるトークンを返す。nil なら付けない
+	TokenSource() (oauth2.TokenSource, error)
+}
+
+// newAIAuthenticator は AI_SERVER_AUTH に応じて認証を作る。
+//   - idtoken（既定）: audience 向けの Google の ID トークン。認証情報は AI_SERVER_CREDENTIALS_FILE、
+//     GCP_PROJECT_ID / GCP_PRIVATE_KEY / GCP_CLIENT_EMAIL、アプリケーションのデフォルト認証情報
+//     （GOOGLE_APPLICATION_CREDENTIALS やメタデータサーバー）の順に探す
+//   - bearer: AI_SERVER_TOKEN を Bearer トークンとして付ける
+//   - mtls: AI_SERVER_CLIENT_CERT / AI_SERVER_CLIENT_KEY のクライアント証明書で接続する。
+//     AI_SERVER_CA_CERT を指定するとサーバー証明書をその CA で検証する
+//   - none: 認証しない（cmd/fakeai などローカルのサーバー向け）
+func newAIAuthenticator(audience string) (aiAuthenticator, error) {
+	switch mode := os.Getenv("AI_SERVER_AUTH"); mode {
+	case "", "idtoken":
+		return &idTokenAuthenticator{audience: audience}, nil
+	case "bearer":
+		token := os.Getenv("AI_SERVER_TOKEN")
+		if token == "" {
+			return nil, errors.New("AI_SERVER_TOKEN is required for bearer authentication")
+		}
+		return bearerAuthenticator{token: token}, nil
+	case "mtls":
+		return newMTLSAuthenticator()
+	case "none":
+		return noneAuthenticator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown AI_SERVER_AUTH: %q", mode)
+	}
+}
+
+type noneAuthenticator struct{}
+
+func (noneAuthenticator) TLSConfig() *tls.Config { return nil }
+
+func (noneAuthenticator) TokenSource() (oauth2.TokenSource, error) { return nil, nil }
+
+type bearerAuthenticator struct {
+	token string
+}
+
+func (bearerAuthenticator) TLSConfig() *tls.Config { return nil }
+
+func (ba bearerAuthenticator) TokenSource() (oauth2.TokenSource, error) {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: ba.token, TokenType: "Bearer"}), nil
+}
+
+type mtlsAuthenticator struct {
+	config *tls.Config
+}
+
+func newMTLSAuthenticator() (*mtlsAuthenticator, error) {
+	certFile, keyFile := os.Getenv("AI_SERVER_CLIENT_CERT"), os.Getenv("AI_SERVER_CLIENT_KEY")
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("AI_SERVER_CLIENT_CERT and AI_SERVER_CLIENT_KEY are required for mtls authentication")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if caFile := os.Getenv("AI_SERVER_CA_CERT"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	return &mtlsAuthenticator{config: config}, nil
+}
+
+func (ma *mtlsAuthenticator) TLSConfig() *tls.Config { return ma.config }
+
+func (*mtlsAuthenticator) TokenSource() (oauth2.TokenSource, error) { return nil, nil }
+
+type idTokenAuthenticator struct {
+	audience string
+}
+
+func (*idTokenAuthenticator) TLSConfig() *tls.Config { return nil }
+
+// TokenSource はトークンの更新に使われるため、期限のないコンテキストで作る
+func (ia *idTokenAuthenticator) TokenSource() (oauth2.TokenSource, error) {
+	var opts []option.ClientOption
+	if file := os.Getenv("AI_SERVER_CREDENTIALS_FILE"); file != "" {
+		opts = append(opts, option.WithCredentialsFile(file))
+	} else if os.Getenv("GCP_PRIVATE_KEY") != "" {
+		credentialsJSON, err := gcpCredentialsJSON()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, option.WithCredentialsJSON(credentialsJSON))
+	}
+	// 認証情報を指定しなければ、アプリケーションのデフォルト認証情報（メタデータサーバーなど）を使う
+	ts, err := idtoken.NewTokenSource(context.Background(), ia.audience, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create id token source: %w", err)
+	}
+	return ts, nil
+}
+
+// gcpCredentialsJSON は GCP_PROJECT_ID / GCP_PRIVATE_KEY / GCP_CLIENT_EMAIL からサービスアカウントの認証情報を作る
+func gcpCredentialsJSON() ([]byte, error) {
+	projectID := os.Getenv("GCP_PROJECT_ID")
+	privateKey := os.Getenv("GCP_PRIVATE_KEY")
+	clientEmail := os.Getenv("GCP_CLIENT_EMAIL")
+
+	if projectID == "" || privateKey == "" || clientEmail == "" {
+		return nil, errors.New("failed to get credencial: GCP_PROJECT_ID, GCP_PRIVATE_KEY and GCP_CLIENT_EMAIL are required")
+	}
+	// Build service account JSON from individual fields
+	serviceAccountJSON := map[string]interface{}{
+		"type":            "service_account",
+		"project_id":      projectID,
+		"private_key":     strings.ReplaceAll(privateKey, "\\n", "\n"), // Handle escaped newlines
+		"client_email":    clientEmail,
+		"token_uri":       "https://oauth2.googleapis.com/token",
+		"auth_uri":        "https://accounts.google.com/o/oauth2/auth",
+		"universe_domain": "googleapis.com",
+	}
+
+	credentialsJSON, err := json.Marshal(serviceAccountJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal service account JSON: %w", err)
+	}
+	return credentialsJSON, nil
+}
+
+// newAuthenticatedHTTPClient は認証を付けてリクエストを送る HTTP クライアントを作る
+func newAuthenticatedHTTPClient(auth aiAuthenticator) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config := auth.TLSConfig(); config != nil {
+		transport.TLSClientConfig = config
+	}
+	ts, err := auth.TokenSource()
+	if err != nil {
+		return nil, err
+	}
+	if ts == nil {
+		return &http.Client{Transport: transport}, nil
+	}
+	return &http.Client{Transport: &oauth2.Transport{Source: ts, Base: transport}}, nil
+}
+
+// authDialOptions は認証を付けて gRPC で接続する設定を返す。
+// useInsecure が true なら TLS を使わない（トークンも平文で送る）
+func authDialOptions(auth aiAuthenticator, useInsecure bool) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	switch {
+	case useInsecure && auth.TLSConfig() != nil:
+		return nil, errors.New("mtls authentication requires TLS")
+	case useInsecure:
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	default:
+		config := auth.TLSConfig()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	}
+
+	ts, err := auth.TokenSource()
+	if err != nil {
+		return nil, err
+	}
+	if ts != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{source: ts, requireTLS: !useInsecure}))
+	}
+	return opts, nil
+}
+
+// tokenCredentials は TokenSource のトークンを gRPC の authorization メタデータとして送る
+type tokenCredentials struct {
+	source     oauth2.TokenSource
+	requireTLS bool
+}
+
+func (tc tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := tc.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": token.Type() + " " + token.AccessToken}, nil
+}
+
+func (tc tokenCredentials) RequireTransportSecurity() bool {
+	return tc.requireTLS
+}
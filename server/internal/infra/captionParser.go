@@ -0,0 +1,68 @@
+package infra
+
+import (
+	"errors"
+	"strings"
+)
+
+var errMalformedCaption = errors.New("malformed caption: body is empty")
+
+// parseCaption はモデルの出力を本文とハッシュタグに分ける。
+// 末尾の「#」で始まる語だけからなる行をハッシュタグとみなし、
+// 「<ハッシュタグ>」のような見出しやプレースホルダの行は取り除く
+func parseCaption(raw string) (string, []string, error) {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+
+	var tags []string
+	end := len(lines)
+	for end > 0 {
+		line := strings.TrimSpace(lines[end-1])
+		if line == "" || isCaptionLabel(line) {
+			end--
+			continue
+		}
+		lineTags, ok := hashtagLine(line)
+		if !ok {
+			break
+		}
+		tags = append(lineTags, tags...)
+		end--
+	}
+
+	var body []string
+	for _, line := range lines[:end] {
+		if isCaptionLabel(strings.TrimSpace(line)) {
+			continue
+		}
+		body = append(body, strings.TrimRight(line, " \t"))
+	}
+
+	text := strings.TrimSpace(strings.Join(body, "\n"))
+	if text == "" {
+		return "", tags, errMalformedCaption
+	}
+	return text, tags, nil
+}
+
+// hashtagLine は行がハッシュタグだけからなる場合にそのハッシュタグを返す
+func hashtagLine(line string) ([]string, bool) {
+	fields := strings.Fields(line)
+	for _, f := range fields {
+		if !strings.HasPrefix(f, "#") && !strings.HasPrefix(f, "＃") {
+			return nil, false
+		}
+	}
+	return fields, len(fields) > 0
+}
+
+// isCaptionLabel は出力形式の見出しやプレースホルダの行かどうかを返す
+func isCaptionLabel(line string) bool {
+	if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") {
+		return true
+	}
+	switch strings.TrimRight(strings.ToLower(line), ":：") {
+	case "ハッシュタグ", "投稿文", "hashtags", "caption", "해시태그", "게시글":
+		return true
+	}
+	return false
+}
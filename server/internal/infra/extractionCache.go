@@ -0,0 +1,114 @@
+package infra
+
+import (
+	"bytes"
+	"climbinsight/server/internal/domain"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// extractionCacheVersion はキャッシュのキーの形式を変えた時に古い結果を使わないためのもの
+const extractionCacheVersion = "v1"
+
+// cachedImageEditService は抽出結果を画像ストレージに保存し、同じ画像と座標の抽出ではAIサービスを呼ばずに返す。
+// 保存した結果は索引（Redis かメモリ）から引き、索引の期限が切れた結果は使わない
+type cachedImageEditService struct {
+	inner   domain.IImageEditService
+	storage domain.IImageStorageService
+	index   domain.IExtractionCacheIndex
+}
+
+func NewCachedImageEditService(ies domain.IImageEditService, iss domain.IImageStorageService, index domain.IExtractionCacheIndex) *cachedImageEditService {
+	return &cachedImageEditService{inner: ies, storage: iss, index: index}
+}
+
+func (cs *cachedImageEditService) Extraction(image []byte, points []domain.Point, box *domain.Box) ([]byte, []byte, error) {
+	key := extractionCacheKey(image, points, box)
+
+	// キャッシュが使えなくても抽出は続ける。索引にあっても画像を読めなかった場合はミスとして扱い、抽出し直して保存し直す
+	result, mask, err := cs.lookup(key)
+	if err != nil {
+		log.Printf("failed to read extraction cache: %v\n", err)
+		result, mask = nil, nil
+	}
+	hit := result != nil
+	if err := cs.index.RecordLookup(hit); err != nil {
+		log.Printf("failed to record extraction cache lookup: %v\n", err)
+	}
+	if hit {
+		log.Printf("extraction cache hit: %s\n", key)
+		return result, mask, nil
+	}
+
+	result, mask, err = cs.inner.Extraction(image, points, box)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 保存を待たずに結果を返す
+	go func() {
+		if err := cs.store(key, result, mask); err != nil {
+			log.Printf("failed to store extraction cache: %v\n", err)
+		}
+	}()
+	return result, mask, nil
+}
+
+// lookup は保存済みの結果を返す。ない場合は nil を返す
+func (cs *cachedImageEditService) lookup(key string) ([]byte, []byte, error) {
+	entry, err := cs.index.Get(key)
+	if err != nil || entry == nil {
+		return nil, nil, err
+	}
+	result, err := cs.storage.DownloadImage(entry.ResultKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download cached result: %w", err)
+	}
+	mask, err := cs.storage.DownloadImage(entry.MaskKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download cached mask: %w", err)
+	}
+	return result, mask, nil
+}
+
+// store は結果を画像ストレージに保存してから索引に登録する。
+// 期限切れの結果の削除と同じキーへの保存し直しが重なっても新しい結果を消さないよう、保存するたびに別のオブジェクトキーを使う
+func (cs *cachedImageEditService) store(key string, result []byte, mask []byte) error {
+	generation := uuid.New().String()
+	entry := domain.ExtractionCacheEntry{
+		Key:       key,
+		ResultKey: fmt.Sprintf("cache/extraction/%s/%s/result", key, generation),
+		MaskKey:   fmt.Sprintf("cache/extraction/%s/%s/mask", key, generation),
+	}
+	if err := cs.storage.UploadImage(bytes.NewReader(result), entry.ResultKey, http.DetectContentType(result)); err != nil {
+		return err
+	}
+	if err := cs.storage.UploadImage(bytes.NewReader(mask), entry.MaskKey, http.DetectContentType(mask)); err != nil {
+		return err
+	}
+	return cs.index.Put(entry)
+}
+
+// extractionCacheKey は画像の内容のハッシュと、座標と矩形からキャッシュのキーを作る。
+// 同じ位置をタップし直した場合も同じキーになるよう、座標は丸めて並び順と重複を揃える
+func extractionCacheKey(image []byte, points []domain.Point, box *domain.Box) string {
+	normalized := make([]string, 0, len(points))
+	for _, p := range points {
+		normalized = append(normalized, fmt.Sprintf("%d:%.1f:%.1f", p.Label, p.X, p.Y))
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%x\n%s\n", extractionCacheVersion, sha256.Sum256(image), strings.Join(normalized, ";"))
+	if box != nil {
+		fmt.Fprintf(h, "%.1f:%.1f:%.1f:%.1f\n", box.X1, box.Y1, box.X2, box.Y2)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,188 @@
+package infra
+
+import (
+	"climbinsight/server/internal/domain"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultExtractionCacheTTL = 24 * time.Hour
+	// extractionCacheEntryPrefix は索引のキーの接頭辞。値は extractionCacheEntryPayload の JSON
+	extractionCacheEntryPrefix = "extraction-cache:entry:"
+	// extractionCacheExpiryKey は索引の期限を持つソート済みセット。メンバーは索引の値と同じ JSON、スコアは期限の UNIX 時間
+	extractionCacheExpiryKey = "extraction-cache:expiry"
+	// extractionCacheStatsKey はヒットとミスの回数を持つハッシュ。全ノードで集計する
+	extractionCacheStatsKey = "extraction-cache:stats"
+)
+
+// takeExpiredExtractionCacheScript は期限が切れた結果を ARGV[2] 件まで取り出す。
+// 複数のノードが同じ結果を取り出さないよう、取得と削除を同時に行う
+var takeExpiredExtractionCacheScript = redis.NewScript(`
+local members = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+if #members > 0 then
+	redis.call("ZREM", KEYS[1], unpack(members))
+end
+return members
+`)
+
+// purgeExtractionCacheScript はすべての結果を取り出す
+var purgeExtractionCacheScript = redis.NewScript(`
+local members = redis.call("ZRANGE", KEYS[1], 0, -1)
+redis.call("DEL", KEYS[1])
+return members
+`)
+
+// extractionCacheTTL は EXTRACTION_CACHE_TTL から索引の有効期限を読み込む
+func extractionCacheTTL() (time.Duration, error) {
+	return durationFromEnv("EXTRACTION_CACHE_TTL", defaultExtractionCacheTTL)
+}
+
+type extractionCacheEntryPayload struct {
+	Key       string `json:"key"`
+	ResultKey string `json:"resultKey"`
+	MaskKey   string `json:"maskKey"`
+}
+
+func (p extractionCacheEntryPayload) toDomain() domain.ExtractionCacheEntry {
+	return domain.ExtractionCacheEntry{Key: p.Key, ResultKey: p.ResultKey, MaskKey: p.MaskKey}
+}
+
+// redisExtractionCacheIndex は抽出結果の索引を Redis に保存する
+type redisExtractionCacheIndex struct {
+	Client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisExtractionCacheIndex は REDIS_URL の Redis に接続し、EXTRACTION_CACHE_TTL から有効期限を読み込む
+func NewRedisExtractionCacheIndex() (*redisExtractionCacheIndex, error) {
+	ttl, err := extractionCacheTTL()
+	if err != nil {
+		return nil, err
+	}
+	client, err := newRedisClient()
+	if err != nil {
+		return nil, err
+	}
+	return &redisExtractionCacheIndex{Client: client, ttl: ttl}, nil
+}
+
+func (ri *redisExtractionCacheIndex) Get(key string) (*domain.ExtractionCacheEntry, error) {
+	ctx := context.Background()
+
+	value, err := ri.Client.Get(ctx, extractionCacheEntryPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var payload extractionCacheEntryPayload
+	if err := json.Unmarshal(value, &payload); err != nil {
+		return nil, err
+	}
+	entry := payload.toDomain()
+	return &entry, nil
+}
+
+func (ri *redisExtractionCacheIndex) Put(entry domain.ExtractionCacheEntry) error {
+	ctx := context.Background()
+
+	value, err := json.Marshal(extractionCacheEntryPayload{Key: entry.Key, ResultKey: entry.ResultKey, MaskKey: entry.MaskKey})
+	if err != nil {
+		return err
+	}
+	// 保存し直した結果はオブジェクトキーが異なり別のメンバーになる。古いメンバーは元の期限で取り出され、古い画像だけが消える
+	expiresAt := time.Now().Add(ri.ttl)
+	_, err = ri.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, extractionCacheEntryPrefix+entry.Key, value, ri.ttl)
+		pipe.ZAdd(ctx, extractionCacheExpiryKey, redis.Z{Score: float64(expiresAt.Unix()), Member: value})
+		return nil
+	})
+	return err
+}
+
+func (ri *redisExtractionCacheIndex) RecordLookup(hit bool) error {
+	ctx := context.Background()
+
+	field := "misses"
+	if hit {
+		field = "hits"
+	}
+	return ri.Client.HIncrBy(ctx, extractionCacheStatsKey, field, 1).Err()
+}
+
+func (ri *redisExtractionCacheIndex) Stats() (domain.ExtractionCacheStats, error) {
+	ctx := context.Background()
+
+	values, err := ri.Client.HMGet(ctx, extractionCacheStatsKey, "hits", "misses").Result()
+	if err != nil {
+		return domain.ExtractionCacheStats{}, err
+	}
+	hits, _ := values[0].(string)
+	misses, _ := values[1].(string)
+
+	var stats domain.ExtractionCacheStats
+	stats.Hits, _ = strconv.ParseInt(hits, 10, 64)
+	stats.Misses, _ = strconv.ParseInt(misses, 10, 64)
+	return stats, nil
+}
+
+// TakeExpired は索引のキー自体は Redis の有効期限で消えるので、期限のセットから取り出すだけにする
+func (ri *redisExtractionCacheIndex) TakeExpired(now time.Time, limit int) ([]domain.ExtractionCacheEntry, error) {
+	ctx := context.Background()
+
+	members, err := takeExpiredExtractionCacheScript.Run(ctx, ri.Client, []string{extractionCacheExpiryKey},
+		now.Unix(), limit,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	return decodeExtractionCacheEntries(members)
+}
+
+func (ri *redisExtractionCacheIndex) Purge() ([]domain.ExtractionCacheEntry, error) {
+	ctx := context.Background()
+
+	members, err := purgeExtractionCacheScript.Run(ctx, ri.Client, []string{extractionCacheExpiryKey}).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := decodeExtractionCacheEntries(members)
+	if err != nil {
+		return nil, err
+	}
+
+	// 索引のキーは少しずつ削除する
+	const batchSize = 500
+	for i := 0; i < len(entries); i += batchSize {
+		batch := entries[i:min(i+batchSize, len(entries))]
+		keys := make([]string, 0, len(batch))
+		for _, e := range batch {
+			keys = append(keys, extractionCacheEntryPrefix+e.Key)
+		}
+		if err := ri.Client.Unlink(ctx, keys...).Err(); err != nil {
+			return entries, err
+		}
+	}
+	return entries, nil
+}
+
+func decodeExtractionCacheEntries(members []string) ([]domain.ExtractionCacheEntry, error) {
+	entries := make([]domain.ExtractionCacheEntry, 0, len(members))
+	for _, m := range members {
+		var payload extractionCacheEntryPayload
+		if err := json.Unmarshal([]byte(m), &payload); err != nil {
+			return nil, fmt.Errorf("failed to decode extraction cache entry: %w", err)
+		}
+		entries = append(entries, payload.toDomain())
+	}
+	return entries, nil
+}
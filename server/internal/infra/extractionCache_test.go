@@ -0,0 +1,136 @@
+package infra
+
+import (
+	"climbinsight/server/internal/domain"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingImageEditService は呼ばれた回数を数え、呼ばれるたびに異なる結果を返す
+type countingImageEditService struct {
+	calls atomic.Int32
+}
+
+func (cs *countingImageEditService) Extraction(image []byte, points []domain.Point, box *domain.Box) ([]byte, []byte, error) {
+	n := byte(cs.calls.Add(1))
+	return []byte{'r', n}, []byte{'m', n}, nil
+}
+
+func newTestExtractionCache(t *testing.T) (*cachedImageEditService, *countingImageEditService, *localImageStorageService, *memoryExtractionCacheIndex) {
+	t.Helper()
+
+	t.Setenv("STORAGE_LOCAL_DIR", t.TempDir())
+	t.Setenv("EXTRACTION_CACHE_TTL", "1h")
+	storage, err := NewLocalImageStorageService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := NewMemoryExtractionCacheIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &countingImageEditService{}
+	return NewCachedImageEditService(inner, storage, index), inner, storage, index
+}
+
+// waitForEntry は結果の保存（Extraction が裏で行う）が終わり、索引の結果が want 以外になるまで待つ
+func waitForEntry(t *testing.T, index *memoryExtractionCacheIndex, key string, want *domain.ExtractionCacheEntry) domain.ExtractionCacheEntry {
+	t.Helper()
+
+	for range 200 {
+		entry, _ := index.Get(key)
+		if entry != nil && (want == nil || *entry != *want) {
+			return *entry
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("extraction cache was not stored")
+	return domain.ExtractionCacheEntry{}
+}
+
+func TestCachedImageEditService(t *testing.T) {
+	cs, inner, storage, index := newTestExtractionCache(t)
+	image := []byte("image")
+	points := []domain.Point{{X: 1, Y: 2, Label: domain.PointLabelPositive}}
+	key := extractionCacheKey(image, points, nil)
+
+	extract := func(wantResult string) {
+		t.Helper()
+		result, _, err := cs.Extraction(image, points, nil)
+		if err != nil {
+			t.Fatalf("Extraction: %v", err)
+		}
+		if string(result) != wantResult {
+			t.Fatalf("result = %q, want %q", result, wantResult)
+		}
+	}
+
+	extract("r\x01")
+	first := waitForEntry(t, index, key, nil)
+	extract("r\x01")
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("inner called %d times, want 1", n)
+	}
+
+	// 画像ストレージから消えていればミスとして抽出し直し、別のオブジェクトキーに保存し直す
+	if err := storage.DeleteImage(first.MaskKey); err != nil {
+		t.Fatal(err)
+	}
+	extract("r\x02")
+	second := waitForEntry(t, index, key, &first)
+	if second.ResultKey == first.ResultKey || second.MaskKey == first.MaskKey {
+		t.Errorf("stored again under the same object keys: %+v", second)
+	}
+	extract("r\x02")
+
+	stats, err := index.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (domain.ExtractionCacheStats{Hits: 2, Misses: 2}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestMemoryExtractionCacheIndexReplace(t *testing.T) {
+	t.Setenv("EXTRACTION_CACHE_TTL", "1h")
+	index, err := NewMemoryExtractionCacheIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := domain.ExtractionCacheEntry{Key: "key", ResultKey: "old/result", MaskKey: "old/mask"}
+	if err := index.Put(old); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	replacedAt := time.Now()
+	time.Sleep(time.Millisecond)
+	latest := domain.ExtractionCacheEntry{Key: "key", ResultKey: "new/result", MaskKey: "new/mask"}
+	if err := index.Put(latest); err != nil {
+		t.Fatal(err)
+	}
+
+	// 置き換えられた結果だけが元の期限で取り出され、新しい結果は索引に残る
+	expired, err := index.TakeExpired(replacedAt.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0] != old {
+		t.Errorf("TakeExpired = %+v, want only %+v", expired, old)
+	}
+	if got, _ := index.Get("key"); got == nil || *got != latest {
+		t.Errorf("Get = %+v, want %+v", got, latest)
+	}
+
+	purged, err := index.Purge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0] != latest {
+		t.Errorf("Purge = %+v, want only %+v", purged, latest)
+	}
+	if got, _ := index.Get("key"); got != nil {
+		t.Errorf("Get after Purge = %+v", got)
+	}
+}
@@ -0,0 +1,176 @@
+package infra
+
+import (
+	"bytes"
+	"climbinsight/server/internal/aipb"
+	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/httpclient"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcChunkSize は1つのメッセージで送る画像のバイト数
+const grpcChunkSize = 1 << 20
+
+// grpcImageEditService は gRPC（proto/ai.proto）でAIサービスに画像と抽出範囲を送り、抽出結果を受け取る
+type grpcImageEditService struct {
+	client  aipb.ImageEditServiceClient
+	timeout time.Duration
+	breaker *httpclient.CircuitBreaker
+	// maxImageBytes は受け取る結果画像・マスク画像それぞれの大きさの上限
+	maxImageBytes int
+}
+
+// NewGRPCImageEditService は AI_SERVER_GRPC_ADDR（host:port）に接続するクライアントを作る。
+// AI_SERVER_GRPC_INSECURE=true なら TLS を使わない（ローカル開発用）。
+// 認証は AI_SERVER_AUTH で指定し、ID トークンの audience は AI_SERVER_URL にする。
+// 期限とサーキットブレーカー、受け取る画像の大きさの上限の設定は HTTP と共通
+func NewGRPCImageEditService() (*grpcImageEditService, error) {
+	addr := os.Getenv("AI_SERVER_GRPC_ADDR")
+	if addr == "" {
+		return nil, errors.New("AI_SERVER_GRPC_ADDR is required")
+	}
+	timeout, err := aiServerTimeout()
+	if err != nil {
+		return nil, err
+	}
+	breaker, err := newAIServerBreaker()
+	if err != nil {
+		return nil, err
+	}
+	maxImageBytes, err := aiServerMaxImageBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	useInsecure := false
+	if raw := os.Getenv("AI_SERVER_GRPC_INSECURE"); raw != "" {
+		if useInsecure, err = strconv.ParseBool(raw); err != nil {
+			return nil, fmt.Errorf("invalid AI_SERVER_GRPC_INSECURE: %q", raw)
+		}
+	}
+
+	// TLS を使わない場合、AI_SERVER_AUTH を指定していなければ認証しない
+	var auth aiAuthenticator = noneAuthenticator{}
+	if !useInsecure || os.Getenv("AI_SERVER_AUTH") != "" {
+		if auth, err = newAIAuthenticator(os.Getenv("AI_SERVER_URL")); err != nil {
+			return nil, err
+		}
+	}
+	opts, err := authDialOptions(auth, useInsecure)
+	if err != nil {
+		return nil, err
+	}
+
+	// 接続は最初のリクエストの時に確立される
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	return &grpcImageEditService{
+		client:        aipb.NewImageEditServiceClient(conn),
+		timeout:       timeout,
+		breaker:       breaker,
+		maxImageBytes: maxImageBytes,
+	}, nil
+}
+
+func (gs *grpcImageEditService) Extraction(image []byte, points []domain.Point, box *domain.Box) ([]byte, []byte, error) {
+	if !gs.breaker.Allow() {
+		return nil, nil, httpclient.ErrCircuitOpen
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gs.timeout)
+	defer cancel()
+
+	result, mask, err := gs.extract(ctx, image, points, box)
+	// 接続先の障害を表すコードだけを失敗として数える
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		gs.breaker.Failure()
+	default:
+		gs.breaker.Success()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to process image: %w", err)
+	}
+	return result, mask, nil
+}
+
+func (gs *grpcImageEditService) extract(ctx context.Context, image []byte, points []domain.Point, box *domain.Box) ([]byte, []byte, error) {
+	stream, err := gs.client.Extract(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 送信中にサーバーがストリームを閉じた場合（io.EOF）は、Recv で理由を受け取る
+	if err := sendExtractRequest(stream, image, points, box); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+
+	var result, mask bytes.Buffer
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		// 上限を超えたら残りを受け取らずに打ち切る
+		switch payload := resp.Payload.(type) {
+		case *aipb.ExtractResponse_ResultChunk:
+			if result.Len()+len(payload.ResultChunk) > gs.maxImageBytes {
+				return nil, nil, fmt.Errorf("result image exceeds %d bytes", gs.maxImageBytes)
+			}
+			result.Write(payload.ResultChunk)
+		case *aipb.ExtractResponse_MaskChunk:
+			if mask.Len()+len(payload.MaskChunk) > gs.maxImageBytes {
+				return nil, nil, fmt.Errorf("mask image exceeds %d bytes", gs.maxImageBytes)
+			}
+			mask.Write(payload.MaskChunk)
+		}
+	}
+
+	if result.Len() == 0 {
+		return nil, nil, errors.New("result image not found in response")
+	}
+	if mask.Len() == 0 {
+		return nil, nil, errors.New("mask image not found in response")
+	}
+	return result.Bytes(), mask.Bytes(), nil
+}
+
+// sendExtractRequest は最初に抽出範囲を送り、続けて画像を grpcChunkSize ごとに送る
+func sendExtractRequest(stream aipb.ImageEditService_ExtractClient, image []byte, points []domain.Point, box *domain.Box) error {
+	prompt := &aipb.Prompt{}
+	for _, p := range points {
+		label := aipb.PointLabel_POINT_LABEL_POSITIVE
+		if p.Label == domain.PointLabelNegative {
+			label = aipb.PointLabel_POINT_LABEL_NEGATIVE
+		}
+		prompt.Points = append(prompt.Points, &aipb.Point{X: p.X, Y: p.Y, Label: label})
+	}
+	if box != nil {
+		prompt.Box = &aipb.Box{X1: box.X1, Y1: box.Y1, X2: box.X2, Y2: box.Y2}
+	}
+	if err := stream.Send(&aipb.ExtractRequest{Payload: &aipb.ExtractRequest_Prompt{Prompt: prompt}}); err != nil {
+		return err
+	}
+
+	for offset := 0; offset < len(image); offset += grpcChunkSize {
+		chunk := image[offset:min(offset+grpcChunkSize, len(image))]
+		if err := stream.Send(&aipb.ExtractRequest{Payload: &aipb.ExtractRequest_ImageChunk{ImageChunk: chunk}}); err != nil {
+			return err
+		}
+	}
+	return stream.CloseSend()
+}
@@ -0,0 +1,99 @@
+package infra
+
+import (
+	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/imaging"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+const defaultExtractionMaxEdge = 2048
+
+// downscaleImageEditService は AIサービスに送る前に画像を縮小し、座標と矩形も同じ比率で変換する。
+// AIサービスの通信量と処理時間を減らすため、抽出結果は縮小後の解像度で返る。
+// upscaleMask が true ならマスクだけは元の解像度に拡大して返す
+type downscaleImageEditService struct {
+	inner       domain.IImageEditService
+	maxEdge     int
+	upscaleMask bool
+}
+
+// NewDownscaleImageEditService は EXTRACTION_MAX_EDGE（0 で縮小しない）と
+// EXTRACTION_UPSCALE_MASK から設定を読み込み、ies をラップする
+func NewDownscaleImageEditService(ies domain.IImageEditService) (*downscaleImageEditService, error) {
+	maxEdge := defaultExtractionMaxEdge
+	if raw := os.Getenv("EXTRACTION_MAX_EDGE"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid EXTRACTION_MAX_EDGE: %q", raw)
+		}
+		maxEdge = v
+	}
+
+	upscaleMask := false
+	if raw := os.Getenv("EXTRACTION_UPSCALE_MASK"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXTRACTION_UPSCALE_MASK: %q", raw)
+		}
+		upscaleMask = v
+	}
+
+	return &downscaleImageEditService{inner: ies, maxEdge: maxEdge, upscaleMask: upscaleMask}, nil
+}
+
+func (ds *downscaleImageEditService) Extraction(image []byte, points []domain.Point, box *domain.Box) ([]byte, []byte, error) {
+	if ds.maxEdge == 0 {
+		return ds.inner.Extraction(image, points, box)
+	}
+
+	img, format, err := imaging.Decode(image)
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		// デコードできない形式は縮小せずに送る
+		log.Printf("skip downscaling unsupported image format: %s\n", format)
+		return ds.inner.Extraction(image, points, box)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	b := img.Bounds()
+	width, height := imaging.FitWithin(b.Dx(), b.Dy(), ds.maxEdge)
+	if width == b.Dx() && height == b.Dy() {
+		return ds.inner.Extraction(image, points, box)
+	}
+
+	resized, _, err := imaging.Encode(imaging.Resize(img, width, height), format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode resized image: %w", err)
+	}
+
+	scaleX := float64(width) / float64(b.Dx())
+	scaleY := float64(height) / float64(b.Dy())
+	scaled := make([]domain.Point, len(points))
+	for i, p := range points {
+		scaled[i] = domain.Point{X: p.X * scaleX, Y: p.Y * scaleY, Label: p.Label}
+	}
+	var scaledBox *domain.Box
+	if box != nil {
+		scaledBox = &domain.Box{X1: box.X1 * scaleX, Y1: box.Y1 * scaleY, X2: box.X2 * scaleX, Y2: box.Y2 * scaleY}
+	}
+
+	processed, mask, err := ds.inner.Extraction(resized, scaled, scaledBox)
+	if err != nil || !ds.upscaleMask {
+		return processed, mask, err
+	}
+
+	maskImage, _, err := imaging.Decode(mask)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode mask image: %w", err)
+	}
+	upscaled, _, err := imaging.Encode(imaging.ResizeMask(maskImage, b.Dx(), b.Dy()), imaging.FormatPNG)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode mask image: %w", err)
+	}
+	return processed, upscaled, nil
+}
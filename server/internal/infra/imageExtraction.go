@@ -2,105 +2,154 @@ package infra
 
 import (
 	"archive/zip"
-	"bytes"
 	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/httpclient"
+	"climbinsight/server/internal/zipstream"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"strings"
-
-	"google.golang.org/api/idtoken"
-	"google.golang.org/api/option"
+	"strconv"
+	"time"
 )
 
-type ImageEditService struct{}
+const (
+	defaultAIServerTimeout          = 2 * time.Minute
+	defaultAIServerBreakerThreshold = 5
+	defaultAIServerBreakerCooldown  = 30 * time.Second
+	defaultAIServerMaxImageBytes    = 64 << 20
+	// maxErrorBodyBytes はエラーの時にログに含めるレスポンスの大きさ
+	maxErrorBodyBytes = 4 << 10
+)
 
-func NewImageEditService() *ImageEditService {
-	return &ImageEditService{}
+// ImageEditService は Cloud Run 上のAIサービスに zip で画像と座標を送り、抽出結果を受け取る
+type ImageEditService struct {
+	serverURL string
+	// timeout はリトライを含めた1回の抽出の期限
+	timeout time.Duration
+	client  *httpclient.Client
+	// responseLimits はレスポンスの zip を展開する上限
+	responseLimits zipstream.Limits
 }
 
-func (ies *ImageEditService) Extraction(image []byte, points []domain.Point) ([]byte, []byte, error) {
-	// Marshal points to JSON
-	pointsData := struct {
-		Points []domain.Point `json:"points"`
-	}{
-		Points: points,
+// NewImageEditService は AI_SERVER_URL と AI_SERVER_AUTH（newAIAuthenticator を参照）、AI_SERVER_TIMEOUT / AI_SERVER_MAX_ATTEMPTS /
+// AI_SERVER_BREAKER_THRESHOLD（0 で無効）/ AI_SERVER_BREAKER_COOLDOWN / AI_SERVER_MAX_IMAGE_BYTES から設定を読み込む
+func NewImageEditService() (*ImageEditService, error) {
+	timeout, err := aiServerTimeout()
+	if err != nil {
+		return nil, err
 	}
-	pointsJSON, err := json.Marshal(pointsData)
+	retry := httpclient.DefaultRetryPolicy
+	if retry.MaxAttempts, err = intFromEnv("AI_SERVER_MAX_ATTEMPTS", retry.MaxAttempts); err != nil {
+		return nil, err
+	}
+	breaker, err := newAIServerBreaker()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal points: %w", err)
+		return nil, err
 	}
-
-	// Create zip payload with image binary and points JSON
-	zipBody, err := createZipPayload(image, pointsJSON)
+	maxImageBytes, err := aiServerMaxImageBytes()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create zip payload: %w", err)
+		return nil, err
 	}
 
-	// Send zip request to AI server with Google Cloud authentication
-	aiServerURL := os.Getenv("AI_SERVER_URL") + "/process"
+	serverURL := os.Getenv("AI_SERVER_URL") + "/process"
+	auth, err := newAIAuthenticator(serverURL)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create authenticated HTTP client for Google Cloud Run
-	ctx := context.Background()
+	// 認証付きのクライアントは最初のリクエストの時に作り、以降は使い回す
+	newClient := func() (*http.Client, error) { return newAuthenticatedHTTPClient(auth) }
+	return &ImageEditService{
+		serverURL: serverURL,
+		timeout:   timeout,
+		client:    httpclient.NewClient(newClient, retry, breaker),
+		// 結果画像とマスク画像の2つを受け取る
+		responseLimits: zipstream.Limits{
+			MaxEntryBytes: int64(maxImageBytes),
+			MaxTotalBytes: 2 * int64(maxImageBytes),
+			MaxEntries:    8,
+		},
+	}, nil
+}
 
-	// Get GCP credentials from individual environment variables (preferred) or JSON fallback
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	privateKey := os.Getenv("GCP_PRIVATE_KEY")
-	clientEmail := os.Getenv("GCP_CLIENT_EMAIL")
+// aiServerTimeout は AI_SERVER_TIMEOUT から1回の抽出の期限を読み込む
+func aiServerTimeout() (time.Duration, error) {
+	return durationFromEnv("AI_SERVER_TIMEOUT", defaultAIServerTimeout)
+}
 
-	if projectID == "" || privateKey == "" || clientEmail == "" {
-		return nil, nil, fmt.Errorf("failed to get credencial: %w", err)
+// aiServerMaxImageBytes は AI_SERVER_MAX_IMAGE_BYTES からAIサービスが返す画像1枚あたりの大きさの上限を読み込む
+func aiServerMaxImageBytes() (int, error) {
+	v, err := intFromEnv("AI_SERVER_MAX_IMAGE_BYTES", defaultAIServerMaxImageBytes)
+	if err != nil {
+		return 0, err
 	}
-	// Build service account JSON from individual fields
-	serviceAccountJSON := map[string]interface{}{
-		"type":            "service_account",
-		"project_id":      projectID,
-		"private_key":     strings.ReplaceAll(privateKey, "\\n", "\n"), // Handle escaped newlines
-		"client_email":    clientEmail,
-		"token_uri":       "https://oauth2.googleapis.com/token",
-		"auth_uri":        "https://accounts.google.com/o/oauth2/auth",
-		"universe_domain": "googleapis.com",
+	if v == 0 {
+		return 0, fmt.Errorf("invalid AI_SERVER_MAX_IMAGE_BYTES: %q", os.Getenv("AI_SERVER_MAX_IMAGE_BYTES"))
 	}
+	return v, nil
+}
 
-	credentialsJSON, err := json.Marshal(serviceAccountJSON)
+// newAIServerBreaker は AI_SERVER_BREAKER_THRESHOLD / AI_SERVER_BREAKER_COOLDOWN からサーキットブレーカーを作る
+func newAIServerBreaker() (*httpclient.CircuitBreaker, error) {
+	threshold, err := intFromEnv("AI_SERVER_BREAKER_THRESHOLD", defaultAIServerBreakerThreshold)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal service account JSON: %w", err)
+		return nil, err
 	}
+	cooldown, err := durationFromEnv("AI_SERVER_BREAKER_COOLDOWN", defaultAIServerBreakerCooldown)
+	if err != nil {
+		return nil, err
+	}
+	return httpclient.NewCircuitBreaker(threshold, cooldown), nil
+}
 
-	// Create ID token client with service account credentials
-	client, err := idtoken.NewClient(ctx, aiServerURL, option.WithCredentialsJSON(credentialsJSON))
+func (ies *ImageEditService) Extraction(image []byte, points []domain.Point, box *domain.Box) ([]byte, []byte, error) {
+	// Marshal points and box to JSON
+	pointsData := struct {
+		Points []domain.Point `json:"points"`
+		Box    *domain.Box    `json:"box,omitempty"`
+	}{
+		Points: points,
+		Box:    box,
+	}
+	pointsJSON, err := json.Marshal(pointsData)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create authenticated client: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal points: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", aiServerURL, bytes.NewReader(zipBody))
+	// Send zip request to AI server with Google Cloud authentication
+	ctx, cancel := context.WithTimeout(context.Background(), ies.timeout)
+	defer cancel()
+
+	// zip は送りながら作る。リトライの時は GetBody で作り直す
+	newBody := zipPayloadBody(image, pointsJSON)
+	body, err := newBody()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request body: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", ies.serverURL, body)
 	if err != nil {
+		body.Close()
 		return nil, nil, err
 	}
+	req.GetBody = newBody
 	req.Header.Set("Content-Type", "application/zip")
 
-	resp, err := client.Do(req)
+	resp, err := ies.client.Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
 		return nil, nil, fmt.Errorf("failed to process image: %s, body: %s", resp.Status, string(body))
 	}
 
-	// Read zip response
-	zipResponseData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	// Extract result and mask images from zip response
-	resultImage, maskImage, err := extractImagesFromZip(zipResponseData)
+	resultImage, maskImage, err := extractImagesFromZip(resp.Body, ies.responseLimits)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to extract images from zip response: %w", err)
 	}
@@ -108,70 +157,105 @@ func (ies *ImageEditService) Extraction(image []byte, points []domain.Point) ([]
 	return resultImage, maskImage, nil
 }
 
-// createZipPayload creates a zip file containing the image binary and points JSON
-func createZipPayload(imageBinary []byte, pointsJSON []byte) ([]byte, error) {
-	// Create a buffer to hold the zip data
-	var zipBuffer bytes.Buffer
-	zipWriter := zip.NewWriter(&zipBuffer)
+// durationFromEnv は環境変数から時間を読み込む。未設定なら def を返す
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return d, nil
+}
+
+// intFromEnv は環境変数から 0 以上の整数を読み込む。未設定なら def を返す
+func intFromEnv(name string, def int) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return v, nil
+}
+
+// zipPayloadBody は画像と座標の zip を書き込みながら読める本文を作る関数を返す
+func zipPayloadBody(imageBinary []byte, pointsJSON []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			// 送信が中断されて pr が閉じられると書き込みが失敗し、ゴルーチンも終わる
+			pw.CloseWithError(writeZipPayload(pw, imageBinary, pointsJSON))
+		}()
+		return pr, nil
+	}
+}
+
+// writeZipPayload writes a zip file containing the image binary and points JSON to w
+func writeZipPayload(w io.Writer, imageBinary []byte, pointsJSON []byte) error {
+	zipWriter := zip.NewWriter(w)
 
 	// Add image binary to zip
 	imageWriter, err := zipWriter.Create("image.bin")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create image entry in zip: %w", err)
+		return fmt.Errorf("failed to create image entry in zip: %w", err)
 	}
 	_, err = imageWriter.Write(imageBinary)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write image data to zip: %w", err)
+		return fmt.Errorf("failed to write image data to zip: %w", err)
 	}
 
 	// Add points JSON to zip
 	pointsWriter, err := zipWriter.Create("points.json")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create points entry in zip: %w", err)
+		return fmt.Errorf("failed to create points entry in zip: %w", err)
 	}
 	_, err = pointsWriter.Write(pointsJSON)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write points data to zip: %w", err)
+		return fmt.Errorf("failed to write points data to zip: %w", err)
 	}
 
 	// Close zip writer
 	err = zipWriter.Close()
 	if err != nil {
-		return nil, fmt.Errorf("failed to close zip writer: %w", err)
+		return fmt.Errorf("failed to close zip writer: %w", err)
 	}
-
-	return zipBuffer.Bytes(), nil
+	return nil
 }
 
-// extractImagesFromZip extracts result and mask images from zip response
-func extractImagesFromZip(zipData []byte) ([]byte, []byte, error) {
-	// Create a reader from the zip data
-	zipReader, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create zip reader: %w", err)
-	}
+// extractImagesFromZip reads result and mask images from the zip response while it is being received
+func extractImagesFromZip(r io.Reader, limits zipstream.Limits) ([]byte, []byte, error) {
+	zr := zipstream.NewReader(r, limits)
 
 	var resultImage, maskImage []byte
-
-	// Read files from zip
-	for _, file := range zipReader.File {
-		rc, err := file.Open()
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to open file %s in zip: %w", file.Name, err)
+	for {
+		name, err := zr.Next()
+		if err == io.EOF {
+			break
 		}
-
-		data, err := io.ReadAll(rc)
-		rc.Close()
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read file %s from zip: %w", file.Name, err)
+			return nil, nil, err
 		}
 
-		switch file.Name {
+		// 知らないエントリは読み捨てる（展開した大きさは上限に数える）
+		var dst *[]byte
+		switch name {
 		case "result_image.bin":
-			resultImage = data
+			dst = &resultImage
 		case "mask_image.bin":
-			maskImage = data
+			dst = &maskImage
+		default:
+			continue
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read file %s from zip: %w", name, err)
 		}
+		*dst = data
 	}
 
 	if resultImage == nil {
@@ -0,0 +1,182 @@
+package infra
+
+import (
+	"bytes"
+	"climbinsight/server/internal/aipb"
+	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/fakeai"
+	"image"
+	"image/color"
+	"image/png"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// テスト用の壁の画像。白い背景に、離れた2つの赤いホールド（holdA・holdB）がある
+var (
+	holdA = image.Rect(10, 10, 20, 20)
+	holdB = image.Rect(30, 10, 40, 20)
+)
+
+func wallImage(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 60, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 60; x++ {
+			c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			if p := image.Pt(x, y); p.In(holdA) || p.In(holdB) {
+				c = color.NRGBA{R: 220, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkExtraction は抽出結果のマスクと加工済み画像が、座標と矩形に合っているかを確かめる
+func checkExtraction(t *testing.T, ies domain.IImageEditService) {
+	t.Helper()
+
+	wall := wallImage(t)
+	tests := []struct {
+		name   string
+		points []domain.Point
+		box    *domain.Box
+		// inside はマスクに含まれる座標、outside は含まれない座標
+		inside  []image.Point
+		outside []image.Point
+	}{
+		{
+			name:    "positive point",
+			points:  []domain.Point{{X: 15, Y: 15, Label: domain.PointLabelPositive}},
+			inside:  []image.Point{{10, 10}, {19, 19}},
+			outside: []image.Point{{35, 15}, {5, 5}},
+		},
+		{
+			name: "negative point removes a hold",
+			points: []domain.Point{
+				{X: 15, Y: 15, Label: domain.PointLabelPositive},
+				{X: 35, Y: 15, Label: domain.PointLabelPositive},
+				{X: 36, Y: 16, Label: domain.PointLabelNegative},
+			},
+			inside:  []image.Point{{15, 15}},
+			outside: []image.Point{{35, 15}, {5, 5}},
+		},
+		{
+			name:    "box without positive points",
+			box:     &domain.Box{X1: 28, Y1: 8, X2: 42, Y2: 22},
+			inside:  []image.Point{{28, 8}, {35, 15}, {41, 21}},
+			outside: []image.Point{{15, 15}, {27, 15}, {42, 15}},
+		},
+		{
+			name:    "box limits the region",
+			points:  []domain.Point{{X: 2, Y: 2, Label: domain.PointLabelPositive}},
+			box:     &domain.Box{X1: 0, Y1: 0, X2: 25, Y2: 40},
+			inside:  []image.Point{{2, 2}, {24, 39}},
+			outside: []image.Point{{15, 15}, {25, 2}, {50, 30}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, mask, err := ies.Extraction(wall, tt.points, tt.box)
+			if err != nil {
+				t.Fatalf("Extraction: %v", err)
+			}
+			resultImg, err := png.Decode(bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("failed to decode result: %v", err)
+			}
+			maskImg, err := png.Decode(bytes.NewReader(mask))
+			if err != nil {
+				t.Fatalf("failed to decode mask: %v", err)
+			}
+			if maskImg.Bounds() != image.Rect(0, 0, 60, 40) || resultImg.Bounds() != maskImg.Bounds() {
+				t.Fatalf("bounds = %v / %v, want 60x40", resultImg.Bounds(), maskImg.Bounds())
+			}
+
+			check := func(points []image.Point, want bool) {
+				for _, p := range points {
+					gray := color.GrayModel.Convert(maskImg.At(p.X, p.Y)).(color.Gray).Y
+					alpha := color.NRGBAModel.Convert(resultImg.At(p.X, p.Y)).(color.NRGBA).A
+					if (gray != 0) != want || (alpha == 0xFF) != want {
+						t.Errorf("%v: mask %d, alpha %d, want in mask %v", p, gray, alpha, want)
+					}
+				}
+			}
+			check(tt.inside, true)
+			check(tt.outside, false)
+		})
+	}
+
+	t.Run("undecodable image", func(t *testing.T) {
+		if _, _, err := ies.Extraction([]byte("not an image"), []domain.Point{{X: 1, Y: 1, Label: domain.PointLabelPositive}}, nil); err == nil {
+			t.Error("Extraction succeeded with an undecodable image")
+		}
+	})
+}
+
+func TestImageEditServiceExtraction(t *testing.T) {
+	srv := httptest.NewServer(fakeai.NewHandler())
+	defer srv.Close()
+
+	t.Setenv("AI_SERVER_URL", srv.URL)
+	t.Setenv("AI_SERVER_AUTH", "none")
+	t.Setenv("AI_SERVER_MAX_ATTEMPTS", "1")
+	t.Setenv("AI_SERVER_BREAKER_THRESHOLD", "0")
+	ies, err := NewImageEditService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExtraction(t, ies)
+}
+
+// startFakeGRPCServer は偽のAIサービスの gRPC サーバーを起動し、接続先を環境変数に設定する
+func startFakeGRPCServer(t *testing.T) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	aipb.RegisterImageEditServiceServer(s, fakeai.GRPCServer{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	t.Setenv("AI_SERVER_GRPC_ADDR", lis.Addr().String())
+	t.Setenv("AI_SERVER_GRPC_INSECURE", "true")
+	t.Setenv("AI_SERVER_AUTH", "")
+	t.Setenv("AI_SERVER_BREAKER_THRESHOLD", "0")
+}
+
+func TestGRPCImageEditServiceExtraction(t *testing.T) {
+	startFakeGRPCServer(t)
+	ies, err := NewGRPCImageEditService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExtraction(t, ies)
+}
+
+func TestGRPCImageEditServiceResponseLimit(t *testing.T) {
+	startFakeGRPCServer(t)
+	// 結果画像とマスク画像のどちらも上限を超える
+	t.Setenv("AI_SERVER_MAX_IMAGE_BYTES", "64")
+	ies, err := NewGRPCImageEditService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ies.Extraction(wallImage(t), []domain.Point{{X: 15, Y: 15, Label: domain.PointLabelPositive}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "exceeds 64 bytes") {
+		t.Errorf("err = %v, want the size limit error", err)
+	}
+}
@@ -79,3 +79,27 @@ func (sh *imageStorageService) GeneratePresignedGetURL(fileName string, contentT
 	}
 	return presigned.URL, nil
 }
+
+func (sh *imageStorageService) DownloadImage(fileName string) ([]byte, error) {
+	out, err := sh.Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(sh.BucketName),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", fileName, err)
+	}
+	defer out.Body.Close()
+
+	return io.ReadAll(out.Body)
+}
+
+func (sh *imageStorageService) DeleteImage(fileName string) error {
+	_, err := sh.Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(sh.BucketName),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package infra
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const localPresignExpires = 30 * time.Minute
+
+// localImageStorageService はローカルのディレクトリに画像を保存する開発用のストレージ。
+// 保存した画像は ServeHTTP から署名付きの有効期限つきURLで配信する
+type localImageStorageService struct {
+	Dir        string
+	BaseURL    string
+	SigningKey []byte
+}
+
+func NewLocalImageStorageService() (*localImageStorageService, error) {
+	dir := os.Getenv("STORAGE_LOCAL_DIR")
+	if dir == "" {
+		dir = "tmp/storage"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	baseURL := os.Getenv("STORAGE_LOCAL_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080/storage"
+	}
+
+	// 署名鍵が未設定なら起動ごとに生成する（再起動すると発行済みURLは無効になる）
+	signingKey := []byte(os.Getenv("STORAGE_SIGNING_KEY"))
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+	}
+
+	return &localImageStorageService{
+		Dir:        dir,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		SigningKey: signingKey,
+	}, nil
+}
+
+// objectPath はオブジェクトキーを保存先のパスに変換する。ディレクトリ外を指すキーはエラーにする
+func (ls *localImageStorageService) objectPath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || cleaned != "/"+key {
+		return "", fmt.Errorf("invalid object key: %q", key)
+	}
+	return filepath.Join(ls.Dir, filepath.FromSlash(cleaned)), nil
+}
+
+func (ls *localImageStorageService) UploadImage(file io.Reader, fileName string, contentType string) error {
+	dst, err := ls.objectPath(fileName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// 書き込み途中のファイルが配信されないよう一時ファイルに書いてから置き換える
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		log.Printf("Upload failed: %v\n", err)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	fmt.Printf("✅ Upload succeeded: %s\n", dst)
+	return nil
+}
+
+func (ls *localImageStorageService) DownloadImage(fileName string) ([]byte, error) {
+	src, err := ls.objectPath(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(src)
+}
+
+func (ls *localImageStorageService) DeleteImage(fileName string) error {
+	dst, err := ls.objectPath(fileName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	// 空になったディレクトリも消す。中身が残っていれば失敗するのでそこで止める
+	for dir := filepath.Dir(dst); dir != filepath.Clean(ls.Dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (ls *localImageStorageService) GeneratePresignedGetURL(fileName string, contentType string) (string, error) {
+	if _, err := ls.objectPath(fileName); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(localPresignExpires).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("contentType", contentType)
+	query.Set("expires", expires)
+	query.Set("signature", ls.sign(fileName, contentType, expires))
+
+	return ls.BaseURL + "/" + fileName + "?" + query.Encode(), nil
+}
+
+func (ls *localImageStorageService) sign(key, contentType, expires string) string {
+	mac := hmac.New(sha256.New, ls.SigningKey)
+	mac.Write([]byte(key + "\n" + contentType + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP は GeneratePresignedGetURL で発行したURLの画像を配信する。
+// ルーティング側でプレフィックスを取り除き、パスがオブジェクトキーになるようにして使う
+func (ls *localImageStorageService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	contentType := query.Get("contentType")
+	expires := query.Get("expires")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		http.Error(w, "url expired", http.StatusForbidden)
+		return
+	}
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(ls.sign(key, contentType, expires))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	src, err := ls.objectPath(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(src)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
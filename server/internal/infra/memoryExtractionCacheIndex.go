@@ -0,0 +1,109 @@
+package infra
+
+import (
+	"climbinsight/server/internal/domain"
+	"sync"
+	"time"
+)
+
+// memoryExtractionCacheIndex はプロセス内で抽出結果の索引を保持する。
+// 再起動すると索引は消え、複数ノードでは共有されない。単一ノードでの運用やテスト用
+type memoryExtractionCacheIndex struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	// entries はキーごとの最新の結果
+	entries map[string]domain.ExtractionCacheEntry
+	// expiry は画像ストレージから消していない結果の期限。置き換えられた古い結果も期限まで残す
+	expiry map[domain.ExtractionCacheEntry]time.Time
+	stats  domain.ExtractionCacheStats
+}
+
+// NewMemoryExtractionCacheIndex は EXTRACTION_CACHE_TTL から有効期限を読み込む
+func NewMemoryExtractionCacheIndex() (*memoryExtractionCacheIndex, error) {
+	ttl, err := extractionCacheTTL()
+	if err != nil {
+		return nil, err
+	}
+	return &memoryExtractionCacheIndex{
+		ttl:     ttl,
+		entries: make(map[string]domain.ExtractionCacheEntry),
+		expiry:  make(map[domain.ExtractionCacheEntry]time.Time),
+	}, nil
+}
+
+func (mi *memoryExtractionCacheIndex) Get(key string) (*domain.ExtractionCacheEntry, error) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	entry, ok := mi.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if expiresAt, ok := mi.expiry[entry]; !ok || time.Now().After(expiresAt) {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (mi *memoryExtractionCacheIndex) Put(entry domain.ExtractionCacheEntry) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	mi.entries[entry.Key] = entry
+	mi.expiry[entry] = time.Now().Add(mi.ttl)
+	return nil
+}
+
+func (mi *memoryExtractionCacheIndex) RecordLookup(hit bool) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	if hit {
+		mi.stats.Hits++
+	} else {
+		mi.stats.Misses++
+	}
+	return nil
+}
+
+func (mi *memoryExtractionCacheIndex) Stats() (domain.ExtractionCacheStats, error) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	return mi.stats, nil
+}
+
+func (mi *memoryExtractionCacheIndex) TakeExpired(now time.Time, limit int) ([]domain.ExtractionCacheEntry, error) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	var expired []domain.ExtractionCacheEntry
+	for entry, expiresAt := range mi.expiry {
+		if len(expired) >= limit {
+			break
+		}
+		if !now.After(expiresAt) {
+			continue
+		}
+		expired = append(expired, entry)
+		delete(mi.expiry, entry)
+		// 保存し直された新しい結果は残す
+		if mi.entries[entry.Key] == entry {
+			delete(mi.entries, entry.Key)
+		}
+	}
+	return expired, nil
+}
+
+func (mi *memoryExtractionCacheIndex) Purge() ([]domain.ExtractionCacheEntry, error) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	purged := make([]domain.ExtractionCacheEntry, 0, len(mi.expiry))
+	for entry := range mi.expiry {
+		purged = append(purged, entry)
+	}
+	mi.entries = make(map[string]domain.ExtractionCacheEntry)
+	mi.expiry = make(map[domain.ExtractionCacheEntry]time.Time)
+	return purged, nil
+}
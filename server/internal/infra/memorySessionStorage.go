@@ -0,0 +1,252 @@
+package infra
+
+import (
+	"climbinsight/server/internal/domain"
+	"context"
+	"encoding/json"
+	"maps"
+	"sync"
+	"time"
+)
+
+// memorySessionCleanupInterval は期限切れセッションを掃除する間隔
+const memorySessionCleanupInterval = 1 * time.Minute
+
+type memorySession struct {
+	result    domain.Result
+	events    []domain.Event
+	expiresAt time.Time
+}
+
+// memorySessionStoreService はプロセス内でセッションを保持する ISessionStoreService の実装。
+// Redis版と同じく最後の更新から sessionTTL で失効する。単一ノードでの運用やテスト用
+type memorySessionStoreService struct {
+	mu          sync.Mutex
+	sessions    map[string]*memorySession
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+func NewMemorySessionStoreService() *memorySessionStoreService {
+	ms := &memorySessionStoreService{
+		sessions:    make(map[string]*memorySession),
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(memorySessionCleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ms.evictExpired()
+		}
+	}()
+
+	return ms
+}
+
+func (ms *memorySessionStoreService) evictExpired() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range ms.sessions {
+		if now.After(s.expiresAt) {
+			delete(ms.sessions, id)
+		}
+	}
+}
+
+// session は有効なセッションを返す。create が true なら存在しない場合に作成する。
+// 呼び出し側で mu をロックしておくこと
+func (ms *memorySessionStoreService) session(sessionId string, create bool) *memorySession {
+	s, ok := ms.sessions[sessionId]
+	if ok && time.Now().After(s.expiresAt) {
+		delete(ms.sessions, sessionId)
+		ok = false
+	}
+	if !ok {
+		if !create {
+			return nil
+		}
+		s = &memorySession{}
+		ms.sessions[sessionId] = s
+	}
+	return s
+}
+
+// push はイベントを追加する。呼び出し側で mu をロックしておくこと
+func (ms *memorySessionStoreService) push(s *memorySession, eventType domain.EventType, data any) {
+	payload, _ := json.Marshal(data)
+	s.events = append(s.events, domain.Event{
+		ID:   int64(len(s.events)) + 1,
+		Type: eventType,
+		Data: string(payload),
+	})
+}
+
+// touch は有効期限を延長して購読者に通知する。呼び出し側で mu をロックしておくこと
+func (ms *memorySessionStoreService) touch(sessionId string, s *memorySession) {
+	s.expiresAt = time.Now().Add(sessionTTL)
+	for ch := range ms.subscribers[sessionId] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (ms *memorySessionStoreService) SaveJobStage(sessionId string, stage domain.JobStage) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s := ms.session(sessionId, true)
+	// 終了済み（done / failed）のジョブは上書きしない
+	if s.result.Stage.IsFinished() || s.result.Stage == stage {
+		return nil
+	}
+	s.result.Stage = stage
+	ms.push(s, domain.EventProgress, map[string]string{"stage": string(stage)})
+	ms.touch(sessionId, s)
+	return nil
+}
+
+func (ms *memorySessionStoreService) SaveJobFailure(sessionId string, stage domain.JobStage, reason string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s := ms.session(sessionId, true)
+	// 最初に発生した失敗だけを記録する
+	if s.result.Stage.IsFinished() {
+		return nil
+	}
+	s.result.Stage = domain.JobStageFailed
+	s.result.FailedStage = stage
+	s.result.Reason = reason
+	ms.push(s, domain.EventError, map[string]string{"stage": string(stage), "error": reason})
+	ms.touch(sessionId, s)
+	return nil
+}
+
+func (ms *memorySessionStoreService) SaveProcessedImage(sessionId string, image domain.ProcessedImage) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s := ms.session(sessionId, true)
+	s.result.Image = image.URL
+	s.result.Renditions = maps.Clone(image.Renditions)
+	s.result.OriginalKey = image.OriginalKey
+	s.result.MaskKey = image.MaskKey
+	ms.push(s, domain.EventImage, imagePayload{Image: image.URL, Renditions: image.Renditions})
+	// 画像の保存が終わったら投稿文の生成待ちになる
+	ms.advance(s, domain.JobStageGenerating)
+	ms.touch(sessionId, s)
+	return nil
+}
+
+func (ms *memorySessionStoreService) SaveGeneratedContents(sessionId string, captions []domain.Caption, maxCandidates int) error {
+	if len(captions) == 0 {
+		return nil
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s := ms.session(sessionId, true)
+	if maxCandidates > 0 && len(s.result.Captions)+len(captions) > maxCandidates {
+		return domain.ErrCandidateLimit
+	}
+	s.result.Captions = append(s.result.Captions, captions...)
+	s.result.Content = s.result.Captions[0].String()
+	ms.push(s, domain.EventContent, newContentPayload(s.result.Captions))
+	// 画像処理の段階は ProcessUsecase が管理するので、ここでは done 以外に進めない
+	ms.advance(s, "")
+	ms.touch(sessionId, s)
+	return nil
+}
+
+func (ms *memorySessionStoreService) SaveContentDelta(sessionId string, candidate int, delta domain.CaptionDelta) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s := ms.session(sessionId, true)
+	if s.result.Stage == domain.JobStageFailed {
+		return nil
+	}
+	ms.push(s, domain.EventContentDelta, newContentDeltaPayload(candidate, delta))
+	ms.touch(sessionId, s)
+	return nil
+}
+
+// advance は画像と投稿文の候補が揃っていればジョブを done にし、done の後に結果が更新された場合も
+// 最新の done イベントを追加する。揃っていない場合は next が空でなければその段階に進める。
+// 呼び出し側で mu をロックしておくこと
+func (ms *memorySessionStoreService) advance(s *memorySession, next domain.JobStage) {
+	if s.result.Stage == domain.JobStageFailed {
+		return
+	}
+	switch {
+	case s.result.Image != "" && len(s.result.Captions) > 0:
+		if s.result.Stage != domain.JobStageDone {
+			s.result.Stage = domain.JobStageDone
+			ms.push(s, domain.EventProgress, map[string]string{"stage": string(domain.JobStageDone)})
+		}
+		ms.push(s, domain.EventDone, donePayload{
+			imagePayload:   imagePayload{Image: s.result.Image, Renditions: s.result.Renditions},
+			contentPayload: newContentPayload(s.result.Captions),
+		})
+	case next != "" && s.result.Stage != domain.JobStageDone:
+		s.result.Stage = next
+		ms.push(s, domain.EventProgress, map[string]string{"stage": string(next)})
+	}
+}
+
+func (ms *memorySessionStoreService) GetResult(sessionId string) (*domain.Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s := ms.session(sessionId, false)
+	if s == nil {
+		return nil, nil
+	}
+	result := s.result
+	result.Captions = append([]domain.Caption(nil), s.result.Captions...)
+	result.Renditions = maps.Clone(s.result.Renditions)
+	return &result, nil
+}
+
+func (ms *memorySessionStoreService) GetEvents(sessionId string, afterId int64) ([]domain.Event, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s := ms.session(sessionId, false)
+	if s == nil || afterId >= int64(len(s.events)) {
+		return nil, nil
+	}
+	if afterId < 0 {
+		afterId = 0
+	}
+	return append([]domain.Event(nil), s.events[afterId:]...), nil
+}
+
+func (ms *memorySessionStoreService) Subscribe(ctx context.Context, sessionId string) (<-chan struct{}, error) {
+	notify := make(chan struct{}, 1)
+
+	ms.mu.Lock()
+	if ms.subscribers[sessionId] == nil {
+		ms.subscribers[sessionId] = make(map[chan struct{}]struct{})
+	}
+	ms.subscribers[sessionId][notify] = struct{}{}
+	ms.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		delete(ms.subscribers[sessionId], notify)
+		if len(ms.subscribers[sessionId]) == 0 {
+			delete(ms.subscribers, sessionId)
+		}
+		close(notify)
+	}()
+
+	return notify, nil
+}
@@ -3,22 +3,158 @@ package infra
 import (
 	"climbinsight/server/internal/domain"
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const sessionTTL = 1 * time.Hour
+
+// sessionScriptPrelude はセッション更新スクリプト共通の関数定義。
+// KEYS[1] は結果のハッシュ、KEYS[2] はイベントのリスト、KEYS[3] は更新通知のチャネル
+const sessionScriptPrelude = `
+local function push(kind, data)
+	local id = redis.call("RPUSH", KEYS[2], cjson.encode({type = kind, data = data}))
+	redis.call("PUBLISH", KEYS[3], id)
+	return id
+end
+local function touch(ttl)
+	redis.call("EXPIRE", KEYS[1], ttl)
+	redis.call("EXPIRE", KEYS[2], ttl)
+end
+local function finished()
+	local current = redis.call("HGET", KEYS[1], "stage")
+	return current == "done" or current == "failed"
+end
+`
+
+// saveJobStageScript は終了済み（done / failed）のジョブを上書きせずに段階を更新する
+var saveJobStageScript = redis.NewScript(sessionScriptPrelude + `
+if finished() or redis.call("HGET", KEYS[1], "stage") == ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "stage", ARGV[1])
+push("progress", cjson.encode({stage = ARGV[1]}))
+touch(ARGV[2])
+return 1
+`)
+
+// saveJobFailureScript は最初に発生した失敗だけを記録する
+var saveJobFailureScript = redis.NewScript(sessionScriptPrelude + `
+if finished() then
+	return 0
+end
+redis.call("HSET", KEYS[1], "stage", "failed", "failedStage", ARGV[1], "error", ARGV[2])
+push("error", cjson.encode({stage = ARGV[1], error = ARGV[2]}))
+touch(ARGV[3])
+return 1
+`)
+
+// sessionResultPrelude は画像と投稿文の保存後の状態遷移。
+// 画像と投稿文の候補が揃っていればジョブを done にし、done の後に結果が更新された場合も
+// 最新の done イベントを追加する。揃っていない場合は next が空でなければその段階に進める
+const sessionResultPrelude = sessionScriptPrelude + `
+local function advance(next)
+	local current = redis.call("HGET", KEYS[1], "stage")
+	if current == "failed" then
+		return
+	end
+	local image = redis.call("HGET", KEYS[1], "url")
+	local stored = redis.call("HGET", KEYS[1], "candidates")
+	local renditions = redis.call("HGET", KEYS[1], "renditions")
+	if image and stored then
+		if current ~= "done" then
+			redis.call("HSET", KEYS[1], "stage", "done")
+			push("progress", cjson.encode({stage = "done"}))
+		end
+		local candidates = cjson.decode(stored)
+		local first = candidates[1]
+		push("done", cjson.encode({
+			image = image,
+			renditions = renditions and cjson.decode(renditions) or nil,
+			contents = first.contents,
+			body = first.body,
+			hashtags = first.hashtags,
+			candidates = candidates,
+		}))
+	elseif next ~= "" and current ~= "done" then
+		redis.call("HSET", KEYS[1], "stage", next)
+		push("progress", cjson.encode({stage = next}))
+	end
+end
+`
+
+// saveImageScript は画像のURLを保存する。ARGV[1] は image イベントのペイロード、ARGV[3] はサイズ別のURLのJSON、
+// ARGV[4] と ARGV[5] は元の画像とマスクのオブジェクトキー
+var saveImageScript = redis.NewScript(sessionResultPrelude + `
+redis.call("HSET", KEYS[1], "url", ARGV[2], "renditions", ARGV[3], "originalKey", ARGV[4], "maskKey", ARGV[5])
+push("image", ARGV[1])
+advance(ARGV[6])
+touch(ARGV[7])
+return 1
+`)
+
+// saveCandidatesScript は投稿文の候補を既存の候補の後ろに追加する。ARGV[1] は追加する候補のJSON配列、
+// ARGV[3] は候補の数の上限（0 なら無制限）。上限を超える場合は何も追加せず -1 を返す
+var saveCandidatesScript = redis.NewScript(sessionResultPrelude + `
+local candidates = {}
+local stored = redis.call("HGET", KEYS[1], "candidates")
+if stored then
+	candidates = cjson.decode(stored)
+end
+local added = cjson.decode(ARGV[1])
+local limit = tonumber(ARGV[3])
+if limit > 0 and #candidates + #added > limit then
+	return -1
+end
+for _, c in ipairs(added) do
+	table.insert(candidates, c)
+end
+local first = candidates[1]
+redis.call("HSET", KEYS[1], "candidates", cjson.encode(candidates), "content", first.contents)
+push("content", cjson.encode({
+	contents = first.contents,
+	body = first.body,
+	hashtags = first.hashtags,
+	candidates = candidates,
+}))
+advance("")
+touch(ARGV[2])
+return #candidates
+`)
+
+// saveContentDeltaScript は生成途中の投稿文の差分をイベントとして追加する。ARGV[1] はイベントのペイロード
+var saveContentDeltaScript = redis.NewScript(sessionScriptPrelude + `
+if redis.call("HGET", KEYS[1], "stage") == "failed" then
+	return 0
+end
+push("content-delta", ARGV[1])
+touch(ARGV[2])
+return 1
+`)
+
 type sessionStoreService struct {
 	Client *redis.Client
 }
 
 func NewSessionStoreService() (*sessionStoreService, error) {
+	client, err := newRedisClient()
+	if err != nil {
+		return nil, err
+	}
+	return &sessionStoreService{Client: client}, nil
+}
+
+// newRedisClient は REDIS_URL の Redis に接続する
+func newRedisClient() (*redis.Client, error) {
 	redisURL := os.Getenv("REDIS_URL")
 
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
-		panic("failed to parse Redis URL: " + err.Error())
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
 	}
 
 	client := redis.NewClient(opt)
@@ -27,54 +163,279 @@ func NewSessionStoreService() (*sessionStoreService, error) {
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
-		panic("failed to connect to Redis: " + err.Error())
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	return &sessionStoreService{Client: client}, nil
+	return client, nil
+}
+
+func sessionKey(sessionId string) string {
+	return "session:" + sessionId
+}
+
+// sessionEventsKey はセッションのイベントを発生順に保持するリストのキー
+func sessionEventsKey(sessionId string) string {
+	return "session:" + sessionId + ":events"
+}
+
+// sessionChannel はセッションの更新を通知する pub/sub チャネル名
+func sessionChannel(sessionId string) string {
+	return "session:" + sessionId + ":updated"
+}
+
+func sessionScriptKeys(sessionId string) []string {
+	return []string{sessionKey(sessionId), sessionEventsKey(sessionId), sessionChannel(sessionId)}
+}
+
+// imagePayload は image イベントで配信する画像。renditions はサイズ名ごとのURL
+type imagePayload struct {
+	Image      string            `json:"image"`
+	Renditions map[string]string `json:"renditions,omitempty"`
+}
+
+// candidatePayload は投稿文の候補。contents は本文とハッシュタグをつなげた投稿用の文字列
+type candidatePayload struct {
+	Contents string   `json:"contents"`
+	Body     string   `json:"body"`
+	Hashtags []string `json:"hashtags"`
+}
+
+func newCandidatePayload(caption domain.Caption) candidatePayload {
+	return candidatePayload{Contents: caption.String(), Body: caption.Body, Hashtags: caption.Hashtags}
+}
+
+// contentPayload は content イベントで配信する投稿文。
+// 先頭の候補を contents / body / hashtags に、全候補を candidates に入れる
+type contentPayload struct {
+	candidatePayload
+	Candidates []candidatePayload `json:"candidates"`
+}
+
+func newContentPayload(captions []domain.Caption) contentPayload {
+	candidates := make([]candidatePayload, 0, len(captions))
+	for _, c := range captions {
+		candidates = append(candidates, newCandidatePayload(c))
+	}
+	return contentPayload{candidatePayload: candidates[0], Candidates: candidates}
+}
+
+// contentDeltaPayload は content-delta イベントで配信する生成途中の差分
+type contentDeltaPayload struct {
+	Candidate int    `json:"candidate"`
+	Delta     string `json:"delta"`
+	Reset     bool   `json:"reset,omitempty"`
+}
+
+func newContentDeltaPayload(candidate int, delta domain.CaptionDelta) contentDeltaPayload {
+	return contentDeltaPayload{Candidate: candidate, Delta: delta.Text, Reset: delta.Reset}
+}
+
+// donePayload は done イベントで配信する結果
+type donePayload struct {
+	imagePayload
+	contentPayload
+}
+
+// storedEvent はイベントリストに保存される形式
+type storedEvent struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+func (ss *sessionStoreService) SaveJobStage(sessionId string, stage domain.JobStage) error {
+	ctx := context.Background()
+
+	return saveJobStageScript.Run(ctx, ss.Client, sessionScriptKeys(sessionId),
+		string(stage), int(sessionTTL.Seconds()),
+	).Err()
 }
 
-func (ss *sessionStoreService) SaveProcessedImage(sessionId string, imageUrl string) error {
+func (ss *sessionStoreService) SaveJobFailure(sessionId string, stage domain.JobStage, reason string) error {
 	ctx := context.Background()
-	key := "session:" + sessionId
 
-	err := ss.Client.HSet(ctx, key, "url", imageUrl).Err()
+	return saveJobFailureScript.Run(ctx, ss.Client, sessionScriptKeys(sessionId),
+		string(stage), reason, int(sessionTTL.Seconds()),
+	).Err()
+}
+
+func (ss *sessionStoreService) SaveProcessedImage(sessionId string, image domain.ProcessedImage) error {
+	ctx := context.Background()
+
+	payload, err := json.Marshal(imagePayload{Image: image.URL, Renditions: image.Renditions})
+	if err != nil {
+		return err
+	}
+	renditions := image.Renditions
+	if renditions == nil {
+		renditions = map[string]string{}
+	}
+	renditionsJSON, err := json.Marshal(renditions)
 	if err != nil {
 		return err
 	}
 
-	return ss.Client.Expire(ctx, key, 1*time.Hour).Err()
+	// 画像の保存が終わったら投稿文の生成待ちになる
+	return saveImageScript.Run(ctx, ss.Client, sessionScriptKeys(sessionId),
+		payload, image.URL, renditionsJSON, image.OriginalKey, image.MaskKey,
+		string(domain.JobStageGenerating), int(sessionTTL.Seconds()),
+	).Err()
 }
 
-func (ss *sessionStoreService) SaveGeneratedContent(sessionId string, content string) error {
+func (ss *sessionStoreService) SaveGeneratedContents(sessionId string, captions []domain.Caption, maxCandidates int) error {
+	if len(captions) == 0 {
+		return nil
+	}
 	ctx := context.Background()
-	key := "session:" + sessionId
 
-	err := ss.Client.HSet(ctx, key, "content", content).Err()
+	candidates := make([]candidatePayload, 0, len(captions))
+	for _, c := range captions {
+		candidates = append(candidates, newCandidatePayload(c))
+	}
+	payload, err := json.Marshal(candidates)
 	if err != nil {
 		return err
 	}
 
-	return ss.Client.Expire(ctx, key, 1*time.Hour).Err()
+	// 画像処理の段階は ProcessUsecase が管理するので、ここでは done 以外に進めない。
+	// 同時に追加されても上限を超えないよう、候補の数の確認と追加はスクリプト内で行う
+	count, err := saveCandidatesScript.Run(ctx, ss.Client, sessionScriptKeys(sessionId),
+		payload, int(sessionTTL.Seconds()), maxCandidates,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if count < 0 {
+		return domain.ErrCandidateLimit
+	}
+	return nil
+}
+
+func (ss *sessionStoreService) SaveContentDelta(sessionId string, candidate int, delta domain.CaptionDelta) error {
+	ctx := context.Background()
+
+	payload, err := json.Marshal(newContentDeltaPayload(candidate, delta))
+	if err != nil {
+		return err
+	}
+
+	return saveContentDeltaScript.Run(ctx, ss.Client, sessionScriptKeys(sessionId),
+		payload, int(sessionTTL.Seconds()),
+	).Err()
 }
 
 func (ss *sessionStoreService) GetResult(sessionId string) (*domain.Result, error) {
 	ctx := context.Background()
-	key := "session:" + sessionId
+	key := sessionKey(sessionId)
 
-	values, err := ss.Client.HMGet(ctx, key, "url", "content").Result()
+	values, err := ss.Client.HMGet(ctx, key,
+		"url", "content", "stage", "failedStage", "error", "candidates", "renditions", "originalKey", "maskKey",
+	).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	image, ok1 := values[0].(string)
-	content, ok2 := values[1].(string)
+	image, _ := values[0].(string)
+	content, _ := values[1].(string)
+	stage, _ := values[2].(string)
+	failedStage, _ := values[3].(string)
+	reason, _ := values[4].(string)
+	candidatesJSON, _ := values[5].(string)
+	renditionsJSON, _ := values[6].(string)
+	originalKey, _ := values[7].(string)
+	maskKey, _ := values[8].(string)
 
-	if !ok1 || !ok2 || image == "" || content == "" {
+	if image == "" && content == "" && stage == "" {
 		return nil, nil
 	}
 
+	var candidates []candidatePayload
+	if candidatesJSON != "" {
+		if err := json.Unmarshal([]byte(candidatesJSON), &candidates); err != nil {
+			return nil, fmt.Errorf("failed to decode caption candidates: %w", err)
+		}
+	}
+	captions := make([]domain.Caption, 0, len(candidates))
+	for _, c := range candidates {
+		captions = append(captions, domain.Caption{Body: c.Body, Hashtags: c.Hashtags})
+	}
+
+	var renditions map[string]string
+	if renditionsJSON != "" {
+		if err := json.Unmarshal([]byte(renditionsJSON), &renditions); err != nil {
+			return nil, fmt.Errorf("failed to decode renditions: %w", err)
+		}
+	}
+
 	return &domain.Result{
-		Image:   image,
-		Content: content,
+		Image:       image,
+		Renditions:  renditions,
+		OriginalKey: originalKey,
+		MaskKey:     maskKey,
+		Content:     content,
+		Captions:    captions,
+		Stage:       domain.JobStage(stage),
+		FailedStage: domain.JobStage(failedStage),
+		Reason:      reason,
 	}, nil
 }
+
+func (ss *sessionStoreService) GetEvents(sessionId string, afterId int64) ([]domain.Event, error) {
+	ctx := context.Background()
+
+	// イベントIDはリストの位置 + 1 なので afterId がそのまま開始位置になる
+	values, err := ss.Client.LRange(ctx, sessionEventsKey(sessionId), afterId, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]domain.Event, 0, len(values))
+	for i, v := range values {
+		var se storedEvent
+		if err := json.Unmarshal([]byte(v), &se); err != nil {
+			return nil, fmt.Errorf("failed to decode session event: %w", err)
+		}
+		events = append(events, domain.Event{
+			ID:   afterId + int64(i) + 1,
+			Type: domain.EventType(se.Type),
+			Data: se.Data,
+		})
+	}
+
+	return events, nil
+}
+
+func (ss *sessionStoreService) Subscribe(ctx context.Context, sessionId string) (<-chan struct{}, error) {
+	pubsub := ss.Client.Subscribe(ctx, sessionChannel(sessionId))
+
+	// 購読が確立してから返すことで、直後の更新を取りこぼさないようにする
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	notify := make(chan struct{}, 1)
+	go func() {
+		defer close(notify)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-messages:
+				if !ok {
+					return
+				}
+				// 未処理の通知があれば読み出し側がまとめて再取得するので捨ててよい
+				select {
+				case notify <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return notify, nil
+}
@@ -1,84 +1,110 @@
 package infra
 
 import (
+	"climbinsight/server/internal/domain"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
-
-	"github.com/cohesion-org/deepseek-go"
+	"strings"
 )
 
-const systemMessage = `あなたはInstagram投稿文とハッシュタグを生成するアシスタントです。
-出力形式を厳密に守ってください。本文はカジュアルでテンション高めの口調にしてください。
-出力には余計なコメントを付けず、指定された形式に完全に従ってください。
-ハッシュタグには#{ジム名}、#{グレード}、#{スタイル}を入れてください。
-ハッシュタグには必ず#climbinsight、#ボルダリングを入れてください。`
-
-type generativeClient interface {
-	CreateChatCompletion(
-		ctx context.Context,
-		request *deepseek.ChatCompletionRequest,
-	) (*deepseek.ChatCompletionResponse, error)
+type textGenerateService struct {
+	// providers は優先順に並んだプロバイダ。先頭が失敗したら次を試す
+	providers []textProvider
+	configs   []textProviderConfig
 }
 
-type dummyClient struct{}
+// NewTextGenerateService は TEXT_PROVIDER で指定したプロバイダと、
+// TEXT_FALLBACK_PROVIDERS（カンマ区切り）で指定したフォールバック先を使うサービスを作成する
+func NewTextGenerateService() (*textGenerateService, error) {
+	primary := os.Getenv("TEXT_PROVIDER")
+	if primary == "" {
+		// 未指定の場合は本番のみ DeepSeek を使う
+		if os.Getenv("ENV") == "prd" {
+			primary = "deepseek"
+		} else {
+			primary = "template"
+		}
+	}
 
-func (d dummyClient) CreateChatCompletion(
-	ctx context.Context,
-	request *deepseek.ChatCompletionRequest,
-) (*deepseek.ChatCompletionResponse, error) {
-	return &deepseek.ChatCompletionResponse{
-		Choices: []deepseek.Choice{
-			{
-				Message: deepseek.Message{
-					Content: "仮のテキストです",
-				},
-			},
-		},
-	}, nil
-}
+	names := []string{primary}
+	for _, name := range strings.Split(os.Getenv("TEXT_FALLBACK_PROVIDERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
 
-type textGenerateService struct {
-	client generativeClient
+	tgs := &textGenerateService{}
+	for _, name := range names {
+		provider, config, err := newTextProvider(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create text provider %s: %w", name, err)
+		}
+		tgs.providers = append(tgs.providers, provider)
+		tgs.configs = append(tgs.configs, config)
+	}
+	return tgs, nil
 }
 
-func NewTextGenerateService() *textGenerateService {
-	if os.Getenv("ENV") == "prd" {
-		client := deepseek.NewClient(os.Getenv("DEEPSEEK_API_KEY"))
-		return &textGenerateService{client: client}
-	} else {
-		return &textGenerateService{client: &dummyClient{}}
+// maxCaptionAttempts は出力形式が崩れていた場合に同じプロバイダで生成し直す回数の上限
+const maxCaptionAttempts = 2
+
+func (tgs *textGenerateService) Generate(req domain.CaptionRequest, onDelta func(domain.CaptionDelta)) (domain.Caption, error) {
+	input := withDefaults(req)
+
+	var errs []error
+	for i, provider := range tgs.providers {
+		config := tgs.configs[i]
+
+		caption, err := tgs.generateWith(provider, config, input, onDelta)
+		if err == nil {
+			return caption, nil
+		}
+
+		slog.Warn("text provider failed",
+			slog.String("provider", config.Name),
+			slog.Any("error", err),
+		)
+		errs = append(errs, fmt.Errorf("%s: %w", config.Name, err))
 	}
+	return domain.Caption{}, errors.Join(errs...)
 }
 
-func (tgs *textGenerateService) Generate(grade, gym, style string, tryCount uint) (string, error) {
-	impression := "登れて嬉しかった"
-	userMessage := fmt.Sprintf(`以下の情報を元にInstagramに投稿するための文章とハッシュタグを作ってください。
+// generateWith は1つのプロバイダで投稿文を生成し、本文とハッシュタグに分ける。
+// 本文が取り出せない場合は生成し直し、ハッシュタグが無い場合は入力項目から補う
+func (tgs *textGenerateService) generateWith(provider textProvider, config textProviderConfig, input domain.CaptionRequest, onDelta func(domain.CaptionDelta)) (domain.Caption, error) {
+	var err error
+	for range maxCaptionAttempts {
+		// 生成し直す場合やフォールバックした場合に備えて、先頭の差分で書き直しを指示する
+		var providerDelta func(string)
+		if onDelta != nil {
+			reset := true
+			providerDelta = func(text string) {
+				onDelta(domain.CaptionDelta{Text: text, Reset: reset})
+				reset = false
+			}
+		}
 
-		ジム名: %s
-		グレード: %s
-		スタイル: %s
-		トライ回数: %d
-		感想: %s
-		
-		# 出力形式:
-		<ここに投稿文>
-		
-		<ハッシュタグ>
-		#タグ1 #タグ2 #タグ3 ...
-		`, gym, grade, style, tryCount, impression)
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		var text string
+		text, err = provider.Complete(ctx, input, providerDelta)
+		cancel()
+		if err != nil {
+			// プロバイダ自体のエラーは生成し直さずフォールバック先に任せる
+			return domain.Caption{}, err
+		}
 
-	req := &deepseek.ChatCompletionRequest{
-		Model: deepseek.DeepSeekChat,
-		Messages: []deepseek.ChatCompletionMessage{
-			{Role: deepseek.ChatMessageRoleSystem, Content: systemMessage},
-			{Role: deepseek.ChatMessageRoleUser, Content: userMessage},
-		},
-	}
-	ctx := context.Background()
-	res, err := tgs.client.CreateChatCompletion(ctx, req)
-	if err != nil {
-		return "", err
+		body, tags, parseErr := parseCaption(text)
+		if parseErr != nil {
+			err = parseErr
+			continue
+		}
+		if len(tags) == 0 {
+			tags = input.Language.Hashtags(input.Gym, input.Grade, input.Style)
+		}
+		return domain.NewCaption(input.Language, body, tags), nil
 	}
-	return res.Choices[0].Message.Content, nil
+	return domain.Caption{}, err
 }
@@ -0,0 +1,178 @@
+package infra
+
+import (
+	"climbinsight/server/internal/domain"
+	"fmt"
+	"strings"
+)
+
+const defaultTargetLength = 150
+
+// captionPrompt は言語ごとの投稿文生成用のプロンプト
+type captionPrompt struct {
+	// system は口調・文字数・絵文字・必須ハッシュタグの指示を埋め込むシステムメッセージ
+	system string
+	// user はジム名・グレード・スタイル・トライ回数・感想を埋め込むユーザーメッセージ
+	user              string
+	defaultImpression string
+	tones             map[domain.Tone]string
+	emojis            map[domain.EmojiDensity]string
+	// templateBody はLLMを使わない場合の本文
+	templateBody func(req domain.CaptionRequest) string
+}
+
+var captionPrompts = map[domain.Language]captionPrompt{
+	domain.LanguageJapanese: {
+		system: `あなたはInstagram投稿文とハッシュタグを生成するアシスタントです。
+出力形式を厳密に守ってください。本文は%sにしてください。
+本文は%d文字程度にしてください。%s
+出力には余計なコメントを付けず、指定された形式に完全に従ってください。
+ハッシュタグには#{ジム名}、#{グレード}、#{スタイル}を入れてください。
+ハッシュタグには必ず%sを入れてください。`,
+		user: `以下の情報を元にInstagramに投稿するための文章とハッシュタグを作ってください。
+
+		ジム名: %s
+		グレード: %s
+		スタイル: %s
+		トライ回数: %d
+		感想: %s
+		
+		# 出力形式:
+		<ここに投稿文>
+		
+		<ハッシュタグ>
+		#タグ1 #タグ2 #タグ3 ...
+		`,
+		defaultImpression: "登れて嬉しかった",
+		tones: map[domain.Tone]string{
+			domain.ToneCasual:    "カジュアルでテンション高めの口調",
+			domain.ToneTechnical: "ムーブやホールドの使い方など技術的な内容に触れる落ち着いた口調",
+			domain.ToneHumble:    "控えめで謙虚な口調",
+			domain.ToneHype:      "とにかく勢いがあり、達成感を全面に出した熱い口調",
+		},
+		emojis: map[domain.EmojiDensity]string{
+			domain.EmojiNone: "絵文字は使わないでください。",
+			domain.EmojiFew:  "絵文字は1〜2個程度にしてください。",
+			domain.EmojiMany: "絵文字をたくさん使って賑やかにしてください。",
+		},
+		templateBody: func(req domain.CaptionRequest) string {
+			return fmt.Sprintf("%sで%sの%s課題を%dトライで完登！", req.Gym, req.Grade, req.Style, req.TryCount)
+		},
+	},
+	domain.LanguageEnglish: {
+		system: `You are an assistant that writes Instagram captions and hashtags in English.
+Follow the output format strictly. Write the caption in a %s.
+Keep the caption to about %d characters. %s
+Do not add any extra comments; follow the specified format exactly.
+Include #{gym name}, #{grade} and #{style} as hashtags, without spaces.
+Always include %s in the hashtags.`,
+		user: `Write an Instagram caption and hashtags based on the following information.
+
+Gym: %s
+Grade: %s
+Style: %s
+Attempts: %d
+Impression: %s
+
+# Output format:
+<caption>
+
+<hashtags>
+#tag1 #tag2 #tag3 ...
+`,
+		defaultImpression: "So happy I sent it!",
+		tones: map[domain.Tone]string{
+			domain.ToneCasual:    "casual, upbeat tone",
+			domain.ToneTechnical: "calm tone that talks about the moves, holds and beta",
+			domain.ToneHumble:    "modest, humble tone",
+			domain.ToneHype:      "hyped, high-energy tone that celebrates the send",
+		},
+		emojis: map[domain.EmojiDensity]string{
+			domain.EmojiNone: "Do not use emoji.",
+			domain.EmojiFew:  "Use one or two emoji.",
+			domain.EmojiMany: "Use plenty of emoji.",
+		},
+		templateBody: func(req domain.CaptionRequest) string {
+			return fmt.Sprintf("Sent a %s %s problem at %s in %d tries!", req.Grade, req.Style, req.Gym, req.TryCount)
+		},
+	},
+	domain.LanguageKorean: {
+		system: `당신은 한국어로 인스타그램 게시글과 해시태그를 작성하는 어시스턴트입니다.
+출력 형식을 엄격히 지켜 주세요. 본문은 %s로 작성해 주세요.
+본문은 %d자 정도로 작성해 주세요. %s
+불필요한 설명을 붙이지 말고 지정된 형식을 그대로 따라 주세요.
+해시태그에는 #{암장 이름}, #{난이도}, #{스타일}을 띄어쓰기 없이 넣어 주세요.
+해시태그에는 반드시 %s을 넣어 주세요.`,
+		user: `다음 정보를 바탕으로 인스타그램에 올릴 게시글과 해시태그를 작성해 주세요.
+
+암장 이름: %s
+난이도: %s
+스타일: %s
+시도 횟수: %d
+소감: %s
+
+# 출력 형식:
+<게시글>
+
+<해시태그>
+#태그1 #태그2 #태그3 ...
+`,
+		defaultImpression: "완등해서 기뻤다",
+		tones: map[domain.Tone]string{
+			domain.ToneCasual:    "캐주얼하고 밝은 말투",
+			domain.ToneTechnical: "무브와 홀드 사용법 등 기술적인 내용을 다루는 차분한 말투",
+			domain.ToneHumble:    "겸손하고 담백한 말투",
+			domain.ToneHype:      "완등의 기쁨을 가득 담은 텐션 높은 말투",
+		},
+		emojis: map[domain.EmojiDensity]string{
+			domain.EmojiNone: "이모지는 사용하지 마세요.",
+			domain.EmojiFew:  "이모지는 1~2개 정도만 사용해 주세요.",
+			domain.EmojiMany: "이모지를 많이 사용해서 활기차게 작성해 주세요.",
+		},
+		templateBody: func(req domain.CaptionRequest) string {
+			return fmt.Sprintf("%s에서 %s %s 문제를 %d번 시도 끝에 완등!", req.Gym, req.Grade, req.Style, req.TryCount)
+		},
+	},
+}
+
+// promptFor は言語のプロンプトを返す。未対応の言語は日本語として扱う
+func promptFor(lang domain.Language) captionPrompt {
+	prompt, ok := captionPrompts[lang]
+	if !ok {
+		return captionPrompts[domain.LanguageJapanese]
+	}
+	return prompt
+}
+
+// withDefaults は未指定の項目に既定値を設定したリクエストを返す
+func withDefaults(req domain.CaptionRequest) domain.CaptionRequest {
+	if !req.Language.IsSupported() {
+		req.Language = domain.LanguageJapanese
+	}
+	if req.Impression == "" {
+		req.Impression = promptFor(req.Language).defaultImpression
+	}
+	if req.Tone == "" {
+		req.Tone = domain.ToneCasual
+	}
+	if req.TargetLength == 0 {
+		req.TargetLength = defaultTargetLength
+	}
+	if req.EmojiDensity == "" {
+		req.EmojiDensity = domain.EmojiFew
+	}
+	return req
+}
+
+func buildSystemMessage(req domain.CaptionRequest) string {
+	prompt := promptFor(req.Language)
+	required := strings.Join(req.Language.RequiredHashtags(), "、")
+	if req.Language != domain.LanguageJapanese {
+		required = strings.Join(req.Language.RequiredHashtags(), ", ")
+	}
+	return fmt.Sprintf(prompt.system, prompt.tones[req.Tone], req.TargetLength, prompt.emojis[req.EmojiDensity], required)
+}
+
+func buildUserMessage(req domain.CaptionRequest) string {
+	return fmt.Sprintf(promptFor(req.Language).user, req.Gym, req.Grade, req.Style, req.TryCount, req.Impression)
+}
@@ -0,0 +1,196 @@
+package infra
+
+import (
+	"climbinsight/server/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cohesion-org/deepseek-go"
+)
+
+const defaultTextProviderTimeout = 60 * time.Second
+
+// textProvider は投稿文を生成するプロバイダ。
+// onDelta が nil でなければ生成途中のテキストを順に渡し、最後に全文を返す
+type textProvider interface {
+	Complete(ctx context.Context, input domain.CaptionRequest, onDelta func(string)) (string, error)
+}
+
+// textProviderConfig はプロバイダ共通の設定
+type textProviderConfig struct {
+	Name    string
+	Timeout time.Duration
+}
+
+// textProviderFactories は TEXT_PROVIDER / TEXT_FALLBACK_PROVIDERS で指定できるプロバイダ
+var textProviderFactories = map[string]func() (textProvider, textProviderConfig, error){
+	"deepseek": newDeepSeekProvider,
+	"openai":   newOpenAICompatibleProvider,
+	"template": newTemplateProvider,
+}
+
+func newTextProvider(name string) (textProvider, textProviderConfig, error) {
+	factory, ok := textProviderFactories[name]
+	if !ok {
+		return nil, textProviderConfig{}, fmt.Errorf("unknown text provider: %q", name)
+	}
+	return factory()
+}
+
+// providerTimeout は環境変数からプロバイダのタイムアウトを読み込む
+func providerTimeout(envName string) (time.Duration, error) {
+	raw := os.Getenv(envName)
+	if raw == "" {
+		return defaultTextProviderTimeout, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", envName, err)
+	}
+	return d, nil
+}
+
+type generativeClient interface {
+	CreateChatCompletion(
+		ctx context.Context,
+		request *deepseek.ChatCompletionRequest,
+	) (*deepseek.ChatCompletionResponse, error)
+	CreateChatCompletionStream(
+		ctx context.Context,
+		request *deepseek.StreamChatCompletionRequest,
+	) (deepseek.ChatCompletionStream, error)
+}
+
+// chatProvider は OpenAI 互換の chat completions API で投稿文を生成する
+type chatProvider struct {
+	client generativeClient
+	model  string
+}
+
+func newDeepSeekProvider() (textProvider, textProviderConfig, error) {
+	apiKey := os.Getenv("DEEPSEEK_API_KEY")
+	if apiKey == "" {
+		return nil, textProviderConfig{}, fmt.Errorf("DEEPSEEK_API_KEY is not set")
+	}
+	timeout, err := providerTimeout("DEEPSEEK_TIMEOUT")
+	if err != nil {
+		return nil, textProviderConfig{}, err
+	}
+	model := os.Getenv("DEEPSEEK_MODEL")
+	if model == "" {
+		model = deepseek.DeepSeekChat
+	}
+
+	client, err := deepseek.NewClientWithOptions(apiKey, deepseek.WithTimeout(timeout))
+	if err != nil {
+		return nil, textProviderConfig{}, err
+	}
+	return &chatProvider{client: client, model: model}, textProviderConfig{Name: "deepseek", Timeout: timeout}, nil
+}
+
+// newOpenAICompatibleProvider は OpenAI や llama.cpp / Ollama など OpenAI 互換のエンドポイントを使う。
+// セルフホストの場合は OPENAI_API_KEY を省略できる
+func newOpenAICompatibleProvider() (textProvider, textProviderConfig, error) {
+	baseURL := os.Getenv("OPENAI_BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1/"
+	}
+	model := os.Getenv("OPENAI_MODEL")
+	if model == "" {
+		return nil, textProviderConfig{}, fmt.Errorf("OPENAI_MODEL is not set")
+	}
+	timeout, err := providerTimeout("OPENAI_TIMEOUT")
+	if err != nil {
+		return nil, textProviderConfig{}, err
+	}
+
+	client, err := deepseek.NewClientWithOptions(os.Getenv("OPENAI_API_KEY"),
+		deepseek.WithBaseURL(strings.TrimSuffix(baseURL, "/")+"/"),
+		deepseek.WithTimeout(timeout),
+	)
+	if err != nil {
+		return nil, textProviderConfig{}, err
+	}
+	return &chatProvider{client: client, model: model}, textProviderConfig{Name: "openai", Timeout: timeout}, nil
+}
+
+func (cp *chatProvider) Complete(ctx context.Context, input domain.CaptionRequest, onDelta func(string)) (string, error) {
+	messages := []deepseek.ChatCompletionMessage{
+		{Role: deepseek.ChatMessageRoleSystem, Content: buildSystemMessage(input)},
+		{Role: deepseek.ChatMessageRoleUser, Content: buildUserMessage(input)},
+	}
+	if onDelta != nil {
+		return cp.stream(ctx, messages, onDelta)
+	}
+
+	req := &deepseek.ChatCompletionRequest{
+		Model:    cp.model,
+		Messages: messages,
+	}
+	res, err := cp.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if len(res.Choices) == 0 {
+		return "", fmt.Errorf("empty completion from model %s", cp.model)
+	}
+	return res.Choices[0].Message.Content, nil
+}
+
+// stream はストリーミングで生成し、受け取った差分を onDelta に渡す
+func (cp *chatProvider) stream(ctx context.Context, messages []deepseek.ChatCompletionMessage, onDelta func(string)) (string, error) {
+	stream, err := cp.client.CreateChatCompletionStream(ctx, &deepseek.StreamChatCompletionRequest{
+		Model:    cp.model,
+		Messages: messages,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var text strings.Builder
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, choice := range res.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			text.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("empty completion from model %s", cp.model)
+	}
+	return text.String(), nil
+}
+
+// templateProvider はLLMを使わず、入力から決まった形式の投稿文を組み立てる。
+// 口調・文字数・絵文字の指定は反映しない
+type templateProvider struct{}
+
+func newTemplateProvider() (textProvider, textProviderConfig, error) {
+	return templateProvider{}, textProviderConfig{Name: "template", Timeout: defaultTextProviderTimeout}, nil
+}
+
+func (templateProvider) Complete(ctx context.Context, input domain.CaptionRequest, onDelta func(string)) (string, error) {
+	body := promptFor(input.Language).templateBody(input) + "\n" + input.Impression
+	tags := input.Language.Hashtags(input.Gym, input.Grade, input.Style)
+
+	text := body + "\n\n" + strings.Join(tags, " ")
+	if onDelta != nil {
+		onDelta(text)
+	}
+	return text, nil
+}
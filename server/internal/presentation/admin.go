@@ -0,0 +1,61 @@
+package presentation
+
+import (
+	"climbinsight/server/internal/usecase"
+	"climbinsight/server/utils"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler は運用者向けの API。RequireAdminToken と組み合わせて使う
+type AdminHandler struct {
+	extractionCacheUsecase *usecase.ExtractionCacheUsecase
+}
+
+func NewAdminHandler(ecu *usecase.ExtractionCacheUsecase) *AdminHandler {
+	return &AdminHandler{extractionCacheUsecase: ecu}
+}
+
+// RequireAdminToken は Authorization: Bearer <token> が token と一致するリクエストだけを通す
+func RequireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{Error: "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetExtractionCacheStats は抽出結果のキャッシュのヒット数・ミス数とヒット率を返す
+func (ah *AdminHandler) GetExtractionCacheStats(c *gin.Context) {
+	stats, err := ah.extractionCacheUsecase.Stats()
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "キャッシュの利用状況の取得に失敗しました", err)
+		return
+	}
+
+	hitRate := 0.0
+	if total := stats.Hits + stats.Misses; total > 0 {
+		hitRate = float64(stats.Hits) / float64(total)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"hits":    stats.Hits,
+		"misses":  stats.Misses,
+		"hitRate": hitRate,
+	})
+}
+
+// PurgeExtractionCache は抽出結果のキャッシュを画像ストレージからもすべて削除する
+func (ah *AdminHandler) PurgeExtractionCache(c *gin.Context) {
+	purged, err := ah.extractionCacheUsecase.Purge()
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "キャッシュの削除に失敗しました", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
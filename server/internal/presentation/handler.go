@@ -1,15 +1,20 @@
 package presentation
 
 import (
+	"climbinsight/server/internal/compositing"
+	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/imaging"
 	"climbinsight/server/internal/usecase"
 	"climbinsight/server/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,10 +25,11 @@ type Handler struct {
 	generateUsecase *usecase.GenerateUsecase
 	processUsecase  *usecase.ProcessUsecase
 	resultUsecase   *usecase.ResultUsecase
+	uploadLimits    imaging.Limits
 }
 
-func NewHandler(gu *usecase.GenerateUsecase, pu *usecase.ProcessUsecase, ru *usecase.ResultUsecase) *Handler {
-	return &Handler{generateUsecase: gu, processUsecase: pu, resultUsecase: ru}
+func NewHandler(gu *usecase.GenerateUsecase, pu *usecase.ProcessUsecase, ru *usecase.ResultUsecase, limits imaging.Limits) *Handler {
+	return &Handler{generateUsecase: gu, processUsecase: pu, resultUsecase: ru, uploadLimits: limits}
 }
 
 func (h *Handler) Process(c *gin.Context) {
@@ -34,59 +40,142 @@ func (h *Handler) Process(c *gin.Context) {
 		return
 	}
 
-	uploadFile, err := preseUpdateFile(fh)
+	// アップロード前に画像の中身を検証する
+	uploadFile, err := preseUpdateFile(fh, h.uploadLimits)
 	if err != nil {
-		utils.RespondError(c, http.StatusBadRequest, "画像の読み込みに失敗しました", err)
+		status, message := uploadErrorStatus(err)
+		utils.RespondError(c, status, message, err)
 		return
 	}
 
-	// 画像の座標を取得
+	// 画像の座標と、抽出する範囲を囲む矩形（任意）を取得
 	pointsJson := c.PostForm("points")
-	var points []usecase.Point
-	if err := json.Unmarshal([]byte(pointsJson), &points); err != nil {
+	var prompt usecase.Prompt
+	if err := json.Unmarshal([]byte(pointsJson), &prompt.Points); err != nil {
 		utils.RespondError(c, http.StatusBadRequest, "pointの読み込みに失敗しました", err)
 		return
 	}
+	if boxJson := c.PostForm("box"); boxJson != "" {
+		if err := json.Unmarshal([]byte(boxJson), &prompt.Box); err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "boxの読み込みに失敗しました", err)
+			return
+		}
+	}
+	// 座標が画像の幅・高さに対する割合かどうか（縮小したプレビューで指定する場合に使う）
+	prompt.Normalized, _ = strconv.ParseBool(c.PostForm("normalized"))
+	if err := prompt.Validate(uploadFile.Width, uploadFile.Height); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "抽出範囲の指定が不正です", err)
+		return
+	}
+	// 撮影日時を残すかどうか（位置情報や端末情報は常に削除する）
+	uploadFile.KeepCaptureTime, _ = strconv.ParseBool(c.PostForm("keepCaptureTime"))
+
+	// 背景に適用する効果
+	composite, err := compositing.NewOptions(c.PostForm("effect"), c.PostForm("outlineColor"))
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "効果の指定が不正です", err)
+		return
+	}
+	uploadFile.Composite = composite
 	uuid := uuid.New().String()
 
-	go func(uploadFile *usecase.UploadFile, points []usecase.Point, uuid string) {
-		if err := h.processUsecase.Process(uploadFile, points, uuid); err != nil {
-			utils.RespondError(c, http.StatusInternalServerError, "画像抽出に失敗しました", err)
+	if err := h.processUsecase.Enqueue(uuid); err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "セッションの作成に失敗しました", err)
+		return
+	}
+
+	// 失敗した段階と理由はセッションに記録され、/result から通知される
+	go func(uploadFile *usecase.UploadFile, prompt usecase.Prompt, uuid string) {
+		if err := h.processUsecase.Process(uploadFile, prompt, uuid); err != nil {
+			utils.ReportError("画像抽出に失敗しました", uuid, err)
 			return
 		}
-	}(uploadFile, points, uuid)
+	}(uploadFile, prompt, uuid)
 	// レスポンス出力
 	c.JSON(http.StatusOK, gin.H{
 		"session": uuid,
 	})
 }
 
-func preseUpdateFile(fh *multipart.FileHeader) (*usecase.UploadFile, error) {
+func preseUpdateFile(fh *multipart.FileHeader, limits imaging.Limits) (*usecase.UploadFile, error) {
+	if fh.Size > limits.MaxBytes {
+		return nil, imaging.ErrTooLarge
+	}
+
 	file, err := fh.Open()
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	imageBytes, err := io.ReadAll(file)
+	// 申告されたサイズを信用せず、上限を超えた時点で読み込みをやめる
+	imageBytes, err := io.ReadAll(io.LimitReader(file, limits.MaxBytes+1))
 	if err != nil {
 		return nil, err
 	}
 
+	info, err := imaging.Validate(imageBytes, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Content-Type はクライアントの申告ではなく判定した形式を使う
+	width, height := info.OrientedSize()
 	return &usecase.UploadFile{
 		FileName:    fh.Filename,
-		ContentType: fh.Header.Get("Content-Type"),
+		ContentType: info.Format.ContentType(),
 		Data:        &imageBytes,
+		Width:       width,
+		Height:      height,
 	}, nil
 }
 
+// uploadErrorStatus は画像の検証エラーに対応するステータスコードとメッセージを返す
+func uploadErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge, "画像のファイルサイズが大きすぎます"
+	case errors.Is(err, imaging.ErrAnimated):
+		return http.StatusUnsupportedMediaType, "アニメーション画像には対応していません"
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		return http.StatusUnsupportedMediaType, "対応していない画像形式です（JPEG / PNG / WebP）"
+	case errors.Is(err, imaging.ErrDimensionsTooLarge):
+		return http.StatusUnprocessableEntity, "画像の縦横のサイズが大きすぎます"
+	case errors.Is(err, imaging.ErrCorrupt):
+		return http.StatusUnprocessableEntity, "画像を読み込めませんでした"
+	default:
+		return http.StatusBadRequest, "画像の読み込みに失敗しました"
+	}
+}
+
 type ContentRequest struct {
-	SessionId  string `json:"sessionId"`
-	Grade      string `json:"grade"`
-	Gym        string `json:"gym"`
-	Style      string `json:"style"`
-	TryCount   uint   `json:"tryCount"`
-	IsGenerate bool   `json:"isGenerate"`
+	SessionId    string `json:"sessionId"`
+	Grade        string `json:"grade"`
+	Gym          string `json:"gym"`
+	Style        string `json:"style"`
+	TryCount     uint   `json:"tryCount"`
+	IsGenerate   bool   `json:"isGenerate"`
+	Impression   string `json:"impression"`
+	Tone         string `json:"tone"`
+	TargetLength int    `json:"targetLength"`
+	EmojiDensity string `json:"emojiDensity"`
+	Language     string `json:"language"`
+	Candidates   int    `json:"candidates"`
+}
+
+func (req ContentRequest) toContents() usecase.Contents {
+	return usecase.Contents{
+		Grade:        req.Grade,
+		Gym:          req.Gym,
+		Style:        req.Style,
+		TryCount:     uint(req.TryCount),
+		Impression:   req.Impression,
+		Tone:         domain.Tone(req.Tone),
+		TargetLength: req.TargetLength,
+		EmojiDensity: domain.EmojiDensity(req.EmojiDensity),
+		Language:     domain.Language(req.Language),
+		Candidates:   req.Candidates,
+	}
 }
 
 func (h *Handler) Generate(c *gin.Context) {
@@ -98,16 +187,15 @@ func (h *Handler) Generate(c *gin.Context) {
 
 	fmt.Print(req)
 
-	content := usecase.Contents{
-		Grade:    req.Grade,
-		Gym:      req.Gym,
-		Style:    req.Style,
-		TryCount: uint(req.TryCount),
+	content := req.toContents()
+	if err := content.Validate(); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "リクエストの内容が不正です", err)
+		return
 	}
 
 	go func(content usecase.Contents, sessionId string, isGenerate bool) {
 		if err := h.generateUsecase.Generate(content, sessionId, isGenerate); err != nil {
-			utils.RespondError(c, http.StatusBadRequest, "コンテントの保存に失敗しました", err)
+			utils.ReportError("コンテントの保存に失敗しました", sessionId, err)
 			return
 		}
 	}(content, req.SessionId, req.IsGenerate)
@@ -119,6 +207,102 @@ func (h *Handler) Generate(c *gin.Context) {
 
 }
 
+type CaptionResponse struct {
+	Contents string   `json:"contents"`
+	Body     string   `json:"body"`
+	Hashtags []string `json:"hashtags"`
+}
+
+// Regenerate は画像抽出をやり直さずに既存のセッションへ投稿文の候補を追加する。
+// 追加した候補はレスポンスで返し、/result にも content イベントとして配信する
+func (h *Handler) Regenerate(c *gin.Context) {
+	var req ContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "リクエストの読み込みに失敗しました", err)
+		return
+	}
+
+	content := req.toContents()
+	if err := content.Validate(); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "リクエストの内容が不正です", err)
+		return
+	}
+
+	captions, err := h.generateUsecase.Regenerate(content, req.SessionId)
+	switch {
+	case errors.Is(err, usecase.ErrSessionNotFound):
+		utils.RespondError(c, http.StatusNotFound, "セッションが見つかりません", err)
+		return
+	case errors.Is(err, usecase.ErrSessionFailed), errors.Is(err, usecase.ErrTooManyCandidates):
+		utils.RespondError(c, http.StatusConflict, "投稿文を追加できません", err)
+		return
+	case err != nil:
+		utils.RespondError(c, http.StatusBadGateway, "投稿文の生成に失敗しました", err)
+		return
+	}
+
+	candidates := make([]CaptionResponse, 0, len(captions))
+	for _, caption := range captions {
+		candidates = append(candidates, CaptionResponse{
+			Contents: caption.String(),
+			Body:     caption.Body,
+			Hashtags: caption.Hashtags,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"candidates": candidates,
+	})
+}
+
+type RenderRequest struct {
+	Effect       string `json:"effect"`
+	OutlineColor string `json:"outlineColor"`
+}
+
+// Render は保存済みの元の画像とマスクから、別の効果で加工済み画像を作り直す。
+// 作り直した画像はレスポンスで返し、/result にも image イベントとして配信する
+func (h *Handler) Render(c *gin.Context) {
+	var req RenderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "リクエストの読み込みに失敗しました", err)
+		return
+	}
+	composite, err := compositing.NewOptions(req.Effect, req.OutlineColor)
+	if err == nil && composite.Effect == compositing.EffectNone {
+		err = errors.New("effect is required")
+	}
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "効果の指定が不正です", err)
+		return
+	}
+
+	processed, err := h.processUsecase.Render(c.Param("session"), composite)
+	switch {
+	case errors.Is(err, usecase.ErrSessionNotFound):
+		utils.RespondError(c, http.StatusNotFound, "セッションが見つかりません", err)
+		return
+	case errors.Is(err, usecase.ErrSessionFailed), errors.Is(err, usecase.ErrImageNotReady):
+		utils.RespondError(c, http.StatusConflict, "画像を作り直せません", err)
+		return
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		utils.RespondError(c, http.StatusUnprocessableEntity, "この画像形式には効果を適用できません", err)
+		return
+	case err != nil:
+		utils.RespondError(c, http.StatusInternalServerError, "画像の作り直しに失敗しました", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"image":      processed.URL,
+		"renditions": processed.Renditions,
+	})
+}
+
+// resultFallbackInterval は更新通知を取りこぼした場合に備えて結果を再取得する間隔
+const resultFallbackInterval = 5 * time.Second
+
+// GetResult はセッションのイベント（progress / image / content / error / done）をSSEで配信する。
+// 再接続時は Last-Event-ID ヘッダー（または lastEventId クエリ）以降のイベントから再開する
 func (h *Handler) GetResult(c *gin.Context) {
 	sessionID := c.Query("session")
 	if sessionID == "" {
@@ -126,7 +310,14 @@ func (h *Handler) GetResult(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
+	lastEventID, err := parseLastEventID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+		return
+	}
+
+	// クライアントが切断したら購読も終了する
+	ctx := c.Request.Context()
 
 	// SSE用のヘッダー
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
@@ -134,43 +325,90 @@ func (h *Handler) GetResult(c *gin.Context) {
 	c.Writer.Header().Set("Connection", "keep-alive")
 	c.Writer.Flush()
 
-	// タイムアウト付きContext（30秒など）
+	// タイムアウト付きContext
 	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	ticker := time.NewTicker(1 * time.Second)
+	// 更新通知を購読する。購読できない場合は定期的な再取得だけで待つ
+	updates, err := h.resultUsecase.Subscribe(timeoutCtx, sessionID)
+	if err != nil {
+		log.Println("Redis subscribe error:", err)
+	}
+
+	ticker := time.NewTicker(resultFallbackInterval)
 	defer ticker.Stop()
 	for {
+		// Redisから未送信のイベントを取得
+		events, err := h.resultUsecase.GetEvents(sessionID, lastEventID)
+		if err != nil {
+			log.Println("Redis error:", err)
+			return
+		}
+		// 再生成や画像の作り直しで done の後にもイベントが追加されるため、保存済みのイベントをすべて送り、
+		// 最後のイベントが終了を表す場合だけ閉じる
+		terminal := false
+		for _, event := range events {
+			writeEvent(c, event)
+			lastEventID = event.ID
+			terminal = event.IsTerminal()
+		}
+		c.Writer.Flush()
+		if terminal {
+			return
+		}
+		if len(events) == 0 {
+			// 終了イベントの ID から再開した場合は新しいイベントが届かないので、ジョブが終了していれば閉じる
+			result, err := h.resultUsecase.GetResult(sessionID)
+			if err != nil {
+				log.Println("Redis error:", err)
+				return
+			}
+			if result != nil && result.Stage.IsFinished() {
+				return
+			}
+		}
+
 		select {
 		case <-timeoutCtx.Done():
+			if ctx.Err() != nil {
+				// クライアントが切断済み
+				return
+			}
 			// タイムアウト時に終了
 			fmt.Fprintf(c.Writer, "event: timeout\ndata: {\"error\": \"timeout\"}\n\n")
 			c.Writer.Flush()
 			return
 
-		case <-ticker.C:
-			// Redisからデータを取得
-			data, err := h.resultUsecase.GetResult(sessionID)
-			if err != nil {
-				log.Println("Redis error:", err)
-				return
+		case _, ok := <-updates:
+			if !ok {
+				// 購読が切れた場合は再取得のみで待つ
+				updates = nil
 			}
 
-			// 条件チェック
-			if data != nil {
-				// 揃ったらレスポンスを返して終了
-				jsonData, _ := json.Marshal(map[string]string{
-					"image":    data.Image,
-					"contents": data.Content,
-				})
-				fmt.Fprintf(c.Writer, "data: %s\n\n", jsonData)
-				c.Writer.Flush()
-				return
-			}
+		case <-ticker.C:
 		}
 	}
 }
 
+func parseLastEventID(c *gin.Context) (int64, error) {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("lastEventId")
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid event id: %q", raw)
+	}
+	return id, nil
+}
+
+func writeEvent(c *gin.Context, event domain.Event) {
+	fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
+
 type InqueryBody struct {
 	Category string `json:"category"`
 	Email    string `json:"email"`
@@ -0,0 +1,95 @@
+package presentation
+
+import (
+	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/imaging"
+	"climbinsight/server/internal/infra"
+	"climbinsight/server/internal/usecase"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetResultResume(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ss := infra.NewMemorySessionStoreService()
+	// done まで進んだセッション
+	if err := ss.SaveJobStage("done", domain.JobStageQueued); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.SaveProcessedImage("done", domain.ProcessedImage{URL: "http://example.com/image.png"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.SaveGeneratedContents("done", []domain.Caption{{Body: "body"}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// 失敗したセッション
+	if err := ss.SaveJobStage("failed", domain.JobStageQueued); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.SaveJobFailure("failed", domain.JobStageExtracting, "extraction failed"); err != nil {
+		t.Fatal(err)
+	}
+	// 処理中のセッション
+	if err := ss.SaveJobStage("running", domain.JobStageExtracting); err != nil {
+		t.Fatal(err)
+	}
+
+	lastID := func(sessionID string) int64 {
+		events, err := ss.GetEvents(sessionID, 0)
+		if err != nil || len(events) == 0 {
+			t.Fatalf("%s: no events (%v)", sessionID, err)
+		}
+		return events[len(events)-1].ID
+	}
+
+	h := NewHandler(nil, nil, usecase.NewResultUsecase(ss), imaging.Limits{})
+	r := gin.New()
+	r.GET("/result", h.GetResult)
+
+	tests := []struct {
+		name        string
+		session     string
+		lastEventID int64
+		// wantEvents は送られるイベントの種類
+		wantEvents []string
+		// wantOpen はストリームが閉じずに待ち続けるかどうか
+		wantOpen bool
+	}{
+		{"from the beginning", "done", 0, []string{"progress", "image", "progress", "content", "progress", "done"}, false},
+		{"after done", "done", lastID("done"), nil, false},
+		{"after error", "failed", lastID("failed"), nil, false},
+		{"running", "running", lastID("running"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/result?session="+tt.session, nil)
+			req.Header.Set("Last-Event-ID", strconv.FormatInt(tt.lastEventID, 10))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if open := errors.Is(ctx.Err(), context.DeadlineExceeded); open != tt.wantOpen {
+				t.Errorf("stream open = %v, want %v", open, tt.wantOpen)
+			}
+			var got []string
+			for _, line := range strings.Split(w.Body.String(), "\n") {
+				if name, ok := strings.CutPrefix(line, "event: "); ok {
+					got = append(got, name)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantEvents, ",") {
+				t.Errorf("events = %q, want %q", got, tt.wantEvents)
+			}
+		})
+	}
+}
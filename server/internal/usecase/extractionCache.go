@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"climbinsight/server/internal/domain"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	// extractionCacheSweepInterval は期限が切れた結果を画像ストレージから消す間隔
+	extractionCacheSweepInterval = 10 * time.Minute
+	// extractionCacheSweepBatch は一度に索引から取り出す結果の数
+	extractionCacheSweepBatch = 100
+)
+
+// ExtractionCacheUsecase は抽出結果のキャッシュの管理（利用状況の確認と削除）を行う
+type ExtractionCacheUsecase struct {
+	index   domain.IExtractionCacheIndex
+	storage domain.IImageStorageService
+}
+
+func NewExtractionCacheUsecase(index domain.IExtractionCacheIndex, iss domain.IImageStorageService) *ExtractionCacheUsecase {
+	return &ExtractionCacheUsecase{index: index, storage: iss}
+}
+
+func (eu *ExtractionCacheUsecase) Stats() (domain.ExtractionCacheStats, error) {
+	return eu.index.Stats()
+}
+
+// Purge はキャッシュをすべて削除し、削除した数を返す
+func (eu *ExtractionCacheUsecase) Purge() (int, error) {
+	entries, err := eu.index.Purge()
+	if err != nil && len(entries) == 0 {
+		return 0, err
+	}
+	return len(entries), errors.Join(err, eu.deleteObjects(entries))
+}
+
+// RemoveExpired は期限が切れた結果を画像ストレージから削除し、削除した数を返す
+func (eu *ExtractionCacheUsecase) RemoveExpired(now time.Time) (int, error) {
+	removed := 0
+	for {
+		entries, err := eu.index.TakeExpired(now, extractionCacheSweepBatch)
+		if err != nil {
+			return removed, err
+		}
+		removed += len(entries)
+		if err := eu.deleteObjects(entries); err != nil {
+			return removed, err
+		}
+		if len(entries) < extractionCacheSweepBatch {
+			return removed, nil
+		}
+	}
+}
+
+// SweepExpired は extractionCacheSweepInterval ごとに RemoveExpired を呼び続ける
+func (eu *ExtractionCacheUsecase) SweepExpired() {
+	ticker := time.NewTicker(extractionCacheSweepInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		removed, err := eu.RemoveExpired(now)
+		if err != nil {
+			log.Printf("failed to remove expired extraction cache: %v\n", err)
+		}
+		if removed > 0 {
+			log.Printf("removed %d expired extraction cache entries\n", removed)
+		}
+	}
+}
+
+// deleteObjects は結果の画像を削除する。失敗しても残りの削除は続ける
+func (eu *ExtractionCacheUsecase) deleteObjects(entries []domain.ExtractionCacheEntry) error {
+	var errs []error
+	for _, e := range entries {
+		errs = append(errs, eu.storage.DeleteImage(e.ResultKey), eu.storage.DeleteImage(e.MaskKey))
+	}
+	return errors.Join(errs...)
+}
@@ -2,7 +2,13 @@ package usecase
 
 import (
 	"climbinsight/server/internal/domain"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 type GenerateUsecase struct {
@@ -11,10 +17,65 @@ type GenerateUsecase struct {
 }
 
 type Contents struct {
-	Grade    string `form:"grade"`
-	Gym      string `form:"gym"`
-	Style    string `form:"style"`
-	TryCount uint   `form:"tryCount"`
+	Grade        string              `form:"grade"`
+	Gym          string              `form:"gym"`
+	Style        string              `form:"style"`
+	TryCount     uint                `form:"tryCount"`
+	Impression   string              `form:"impression"`
+	Tone         domain.Tone         `form:"tone"`
+	TargetLength int                 `form:"targetLength"`
+	EmojiDensity domain.EmojiDensity `form:"emojiDensity"`
+	Language     domain.Language     `form:"language"`
+	Candidates   int                 `form:"candidates"`
+}
+
+var (
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrSessionFailed     = errors.New("session has failed")
+	ErrTooManyCandidates = errors.New("too many caption candidates")
+)
+
+const (
+	maxCandidates           = 5
+	maxCandidatesPerSession = 20
+	maxImpressionLength     = 200
+	minTargetLength         = 20
+	maxTargetLength         = 500
+)
+
+// Validate は投稿文生成の指定が受け付けられる値かどうかを検証する
+func (c Contents) Validate() error {
+	if utf8.RuneCountInString(c.Impression) > maxImpressionLength {
+		return fmt.Errorf("impression must be at most %d characters", maxImpressionLength)
+	}
+	switch c.Tone {
+	case "", domain.ToneCasual, domain.ToneTechnical, domain.ToneHumble, domain.ToneHype:
+	default:
+		return fmt.Errorf("unknown tone: %q", c.Tone)
+	}
+	if c.TargetLength != 0 && (c.TargetLength < minTargetLength || c.TargetLength > maxTargetLength) {
+		return fmt.Errorf("targetLength must be between %d and %d", minTargetLength, maxTargetLength)
+	}
+	switch c.EmojiDensity {
+	case "", domain.EmojiNone, domain.EmojiFew, domain.EmojiMany:
+	default:
+		return fmt.Errorf("unknown emojiDensity: %q", c.EmojiDensity)
+	}
+	if c.Language != "" && !c.Language.IsSupported() {
+		return fmt.Errorf("unsupported language: %q", c.Language)
+	}
+	if c.Candidates < 0 || c.Candidates > maxCandidates {
+		return fmt.Errorf("candidates must be between 1 and %d", maxCandidates)
+	}
+	return nil
+}
+
+// candidateCount は生成する候補の数。未指定なら1つ
+func (c Contents) candidateCount() int {
+	if c.Candidates == 0 {
+		return 1
+	}
+	return c.Candidates
 }
 
 func NewGenerateUsecase(tgs domain.ITextGenerateService, sss domain.ISessionStoreService) *GenerateUsecase {
@@ -22,20 +83,141 @@ func NewGenerateUsecase(tgs domain.ITextGenerateService, sss domain.ISessionStor
 }
 
 func (gu *GenerateUsecase) Generate(content Contents, sessionId string, isGenerate bool) error {
-	postText := fmt.Sprintf("#climbinsight #%s #%s #%s", content.Gym, content.Grade, content.Style)
+	// 生成しない場合は言語ごとの必須タグと入力項目のハッシュタグだけを投稿文にする
+	captions := []domain.Caption{
+		domain.NewCaption(content.Language, "", content.Language.Hashtags(content.Gym, content.Grade, content.Style)),
+	}
 	var err error
 	// 投稿文生成処理
 	if isGenerate {
-		postText, err = gu.textGenerateService.Generate(content.Grade, content.Gym, content.Style, content.TryCount)
+		captions, err = gu.generateCandidates(content, sessionId, 0)
 		if err != nil {
-			return err
+			return recordFailure(gu.sessionStoreService, sessionId, domain.JobStageGenerating, err)
 		}
 	}
 
-	if err := gu.sessionStoreService.SaveGeneratedContent(sessionId, postText); err != nil {
-		return err
+	if err := gu.sessionStoreService.SaveGeneratedContents(sessionId, captions, maxCandidatesPerSession); err != nil {
+		return recordFailure(gu.sessionStoreService, sessionId, domain.JobStageGenerating, err)
 	}
 
 	// レスポンス出力
 	return nil
 }
+
+// Regenerate は既存のセッションに投稿文の候補を追加し、追加した候補を返す。
+// 画像抽出はやり直さない。生成に失敗してもセッションのジョブは失敗にしない
+func (gu *GenerateUsecase) Regenerate(content Contents, sessionId string) ([]domain.Caption, error) {
+	result, err := gu.sessionStoreService.GetResult(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, ErrSessionNotFound
+	}
+	if result.Stage == domain.JobStageFailed {
+		return nil, ErrSessionFailed
+	}
+	// 生成する前に上限を確認する。同時に再生成された場合は保存する時に上限で弾く
+	if len(result.Captions)+content.candidateCount() > maxCandidatesPerSession {
+		return nil, ErrTooManyCandidates
+	}
+
+	captions, err := gu.generateCandidates(content, sessionId, len(result.Captions))
+	if err != nil {
+		return nil, err
+	}
+	err = gu.sessionStoreService.SaveGeneratedContents(sessionId, captions, maxCandidatesPerSession)
+	if errors.Is(err, domain.ErrCandidateLimit) {
+		return nil, ErrTooManyCandidates
+	}
+	if err != nil {
+		return nil, err
+	}
+	return captions, nil
+}
+
+// generateCandidates は指定された数の投稿文を並行して生成する。
+// 生成途中のテキストは offset 番目から始まる候補の差分としてセッションに記録する。
+// 一部が失敗しても1つ以上生成できていればそれだけを返す
+func (gu *GenerateUsecase) generateCandidates(content Contents, sessionId string, offset int) ([]domain.Caption, error) {
+	req := domain.CaptionRequest{
+		Grade:        content.Grade,
+		Gym:          content.Gym,
+		Style:        content.Style,
+		TryCount:     content.TryCount,
+		Impression:   content.Impression,
+		Tone:         content.Tone,
+		TargetLength: content.TargetLength,
+		EmojiDensity: content.EmojiDensity,
+		Language:     content.Language,
+	}
+
+	n := content.candidateCount()
+	captions := make([]domain.Caption, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deltas := &deltaBuffer{sessionStoreService: gu.sessionStoreService, sessionId: sessionId, candidate: offset + i}
+			captions[i], errs[i] = gu.textGenerateService.Generate(req, deltas.add)
+			deltas.flush()
+		}()
+	}
+	wg.Wait()
+
+	var generated []domain.Caption
+	for i, c := range captions {
+		if errs[i] == nil {
+			generated = append(generated, c)
+		}
+	}
+	if len(generated) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return generated, nil
+}
+
+// deltaFlushInterval は生成途中の差分をまとめてセッションに記録する間隔
+const deltaFlushInterval = 100 * time.Millisecond
+
+// deltaBuffer は生成途中の差分を一定間隔でまとめてセッションに記録する。
+// 差分の記録に失敗しても生成は続ける
+type deltaBuffer struct {
+	sessionStoreService domain.ISessionStoreService
+	sessionId           string
+	candidate           int
+
+	text      strings.Builder
+	reset     bool
+	flushedAt time.Time
+}
+
+func (b *deltaBuffer) add(delta domain.CaptionDelta) {
+	if delta.Reset {
+		b.text.Reset()
+		b.reset = true
+	}
+	b.text.WriteString(delta.Text)
+	if time.Since(b.flushedAt) >= deltaFlushInterval {
+		b.flush()
+	}
+}
+
+func (b *deltaBuffer) flush() {
+	if b.text.Len() == 0 && !b.reset {
+		return
+	}
+	delta := domain.CaptionDelta{Text: b.text.String(), Reset: b.reset}
+	if err := b.sessionStoreService.SaveContentDelta(b.sessionId, b.candidate, delta); err != nil {
+		slog.Warn("failed to save content delta",
+			slog.String("session", b.sessionId),
+			slog.Any("error", err),
+		)
+	}
+	b.text.Reset()
+	b.reset = false
+	b.flushedAt = time.Now()
+}
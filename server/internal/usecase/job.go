@@ -0,0 +1,15 @@
+package usecase
+
+import (
+	"climbinsight/server/internal/domain"
+	"errors"
+	"fmt"
+)
+
+// recordFailure は失敗した段階と理由をセッションに記録し、元のエラーを返す
+func recordFailure(sss domain.ISessionStoreService, sessionId string, stage domain.JobStage, err error) error {
+	if saveErr := sss.SaveJobFailure(sessionId, stage, err.Error()); saveErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to save job failure: %w", saveErr))
+	}
+	return err
+}
@@ -2,11 +2,13 @@ package usecase
 
 import (
 	"bytes"
+	"climbinsight/server/internal/compositing"
 	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/imaging"
+	"errors"
 	"fmt"
-	"net/http"
-	"path/filepath"
 	"sync"
+	"time"
 )
 
 type ProcessUsecase struct {
@@ -15,95 +17,271 @@ type ProcessUsecase struct {
 	sessionStoreService domain.ISessionStoreService
 }
 
+// ErrImageNotReady は加工済み画像がまだ保存されていないことを表す
+var ErrImageNotReady = errors.New("processed image is not ready")
+
 type UploadFile struct {
 	FileName    string
 	ContentType string
 	Data        *[]byte
-}
-
-type Point struct {
-	X float64 `json:"x"`
-	Y float64 `json:"y"`
+	// Width と Height は向きを揃えた後の画像の幅と高さ
+	Width  int
+	Height int
+	// KeepCaptureTime が true なら保存する画像に撮影日時を残す
+	KeepCaptureTime bool
+	// Composite は加工済み画像に適用する効果。未指定ならAIサービスの加工結果をそのまま使う
+	Composite compositing.Options
 }
 
 func NewProcessUsecase(ies domain.IImageEditService, iss domain.IImageStorageService, sss domain.ISessionStoreService) *ProcessUsecase {
 	return &ProcessUsecase{imageEditService: ies, imageStorageService: iss, sessionStoreService: sss}
 }
 
-// detectImageContentType detects the content type of image binary data
-func detectImageContentType(data []byte) string {
-	// Use http.DetectContentType for automatic detection
-	contentType := http.DetectContentType(data)
-	
-	// Fallback to specific image type detection if http.DetectContentType fails
-	switch {
-	case len(data) >= 8 && data[0] == 0x89 && data[1] == 0x50 && data[2] == 0x4E && data[3] == 0x47:
-		return "image/png"
-	case len(data) >= 3 && data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF:
-		return "image/jpeg"
-	case len(data) >= 6 && string(data[0:6]) == "GIF87a" || string(data[0:6]) == "GIF89a":
-		return "image/gif"
-	case len(data) >= 12 && string(data[8:12]) == "WEBP":
-		return "image/webp"
-	default:
-		// Return the result from http.DetectContentType, or default to PNG
-		if contentType != "application/octet-stream" {
-			return contentType
-		}
-		return "image/png" // Default fallback
+// Enqueue はセッションのジョブを受付済みとして記録する
+func (pu *ProcessUsecase) Enqueue(sessionId string) error {
+	return pu.sessionStoreService.SaveJobStage(sessionId, domain.JobStageQueued)
+}
+
+// Process は画像抽出を実行し、失敗した場合は失敗した段階と理由をセッションに記録する
+func (pu *ProcessUsecase) Process(file *UploadFile, prompt Prompt, sessionId string) error {
+	stage, err := pu.process(file, prompt, sessionId)
+	if err != nil {
+		return recordFailure(pu.sessionStoreService, sessionId, stage, err)
 	}
+	return nil
 }
 
-func (pu *ProcessUsecase) Process(file *UploadFile, points []Point, sessionId string) error {
+func (pu *ProcessUsecase) process(file *UploadFile, prompt Prompt, sessionId string) (domain.JobStage, error) {
 	// 画像を保存
-	originName := fmt.Sprintf("original/%s.%s", sessionId, filepath.Ext(file.FileName))
-	if err := pu.imageStorageService.UploadImage(bytes.NewReader(*file.Data), originName, file.ContentType); err != nil {
-		return err
+	if err := pu.sessionStoreService.SaveJobStage(sessionId, domain.JobStageUploading); err != nil {
+		return domain.JobStageUploading, err
 	}
-
-	var domainPoints []domain.Point
-	for _, p := range points {
-		domainPoints = append(domainPoints, domain.Point{X: p.X, Y: p.Y})
+	// 向きを揃え、位置情報などのメタデータを取り除いてから保存・抽出する
+	opts := imaging.NormalizeOptions{KeepCaptureTime: file.KeepCaptureTime}
+	originalImage, originalFormat, err := imaging.Normalize(*file.Data, opts)
+	if err != nil {
+		return domain.JobStageUploading, err
+	}
+	// キーの拡張子はファイル名ではなく、保存する画像の実際の形式から決める
+	originName := fmt.Sprintf("original/%s.%s", sessionId, originalFormat)
+	if err := pu.imageStorageService.UploadImage(bytes.NewReader(originalImage), originName, originalFormat.ContentType()); err != nil {
+		return domain.JobStageUploading, err
 	}
+
+	domainPoints, box := prompt.toDomain(file.Width, file.Height)
 	// AIサービスにリクエスト
-	processedImage, mask_data, err := pu.imageEditService.Extraction(*file.Data, domainPoints)
+	if err := pu.sessionStoreService.SaveJobStage(sessionId, domain.JobStageExtracting); err != nil {
+		return domain.JobStageExtracting, err
+	}
+	processedImage, mask_data, err := pu.imageEditService.Extraction(originalImage, domainPoints, box)
 	if err != nil {
-		return err
+		return domain.JobStageExtracting, err
 	}
 
-	var wg sync.WaitGroup
+	// AIサービスの出力も保存前にメタデータを取り除く
+	mask_data, maskFormat, err := imaging.Normalize(mask_data, opts)
+	if err != nil {
+		return domain.JobStageExtracting, fmt.Errorf("invalid mask image: %w", err)
+	}
+	processedImage, processedFormat, err := imaging.Normalize(processedImage, opts)
+	if err != nil {
+		return domain.JobStageExtracting, fmt.Errorf("invalid processed image: %w", err)
+	}
 
-	// Detect content types for processed images
-	maskContentType := detectImageContentType(mask_data)
-	processedContentType := detectImageContentType(processedImage)
+	// 効果が指定されていれば、元の画像とマスクから加工済み画像を作り直す
+	if file.Composite.Effect != compositing.EffectNone {
+		if err := pu.sessionStoreService.SaveJobStage(sessionId, domain.JobStageCompositing); err != nil {
+			return domain.JobStageCompositing, err
+		}
+		processedImage, processedFormat, err = compositeImage(originalImage, mask_data, file.Composite)
+		if err != nil {
+			return domain.JobStageCompositing, err
+		}
+	}
+
+	if err := pu.sessionStoreService.SaveJobStage(sessionId, domain.JobStageStoring); err != nil {
+		return domain.JobStageStoring, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
 
 	//画像を保存
-	maskName := fmt.Sprintf("mask/%s.%s", sessionId, filepath.Ext(file.FileName))
+	maskName := fmt.Sprintf("mask/%s.%s", sessionId, maskFormat)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := pu.imageStorageService.UploadImage(bytes.NewReader(mask_data), maskName, maskContentType); err != nil {
-			fmt.Printf("Error uploading mask image: %v\n", err)
+		if err := pu.imageStorageService.UploadImage(bytes.NewReader(mask_data), maskName, maskFormat.ContentType()); err != nil {
+			errs[0] = fmt.Errorf("failed to upload mask image: %w", err)
 		}
 	}()
 
-	processedName := fmt.Sprintf("processed/%s.%s", sessionId, filepath.Ext(file.FileName))
+	processedName := fmt.Sprintf("processed/%s.%s", sessionId, processedFormat)
+	var processed domain.ProcessedImage
 	wg.Add(1) // 待機するゴルーチンの数をさらに1増やす
 	go func() {
 		defer wg.Done() // このゴルーチンが完了したら、待機数を1減らす
-		if err := pu.imageStorageService.UploadImage(bytes.NewReader(processedImage), processedName, processedContentType); err != nil {
-			fmt.Printf("Error uploading processed image: %v\n", err)
-		}
+		var err error
+		processed, err = pu.storeProcessedImage(processedImage, processedFormat, processedName, "renditions/"+sessionId)
+		errs[1] = err
 	}()
 
-	url, err := pu.imageStorageService.GeneratePresignedGetURL(processedName, processedContentType)
-	if err != nil {
-		return err
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return domain.JobStageStoring, err
 	}
+	processed.OriginalKey = originName
+	processed.MaskKey = maskName
 
 	// URLを一時保存
-	pu.sessionStoreService.SaveProcessedImage(sessionId, url)
+	if err := pu.sessionStoreService.SaveProcessedImage(sessionId, processed); err != nil {
+		return domain.JobStageStoring, err
+	}
 
 	// レスポンス出力
-	return nil
+	return domain.JobStageDone, nil
+}
+
+// Render は保存済みの元の画像とマスクから、指定した効果で加工済み画像を作り直してセッションの画像を差し替える。
+// 画像抽出（AIサービス）はやり直さない
+func (pu *ProcessUsecase) Render(sessionId string, opts compositing.Options) (domain.ProcessedImage, error) {
+	result, err := pu.sessionStoreService.GetResult(sessionId)
+	if err != nil {
+		return domain.ProcessedImage{}, err
+	}
+	if result == nil {
+		return domain.ProcessedImage{}, ErrSessionNotFound
+	}
+	if result.Stage == domain.JobStageFailed {
+		return domain.ProcessedImage{}, ErrSessionFailed
+	}
+	if result.OriginalKey == "" || result.MaskKey == "" {
+		return domain.ProcessedImage{}, ErrImageNotReady
+	}
+
+	original, err := pu.imageStorageService.DownloadImage(result.OriginalKey)
+	if err != nil {
+		return domain.ProcessedImage{}, fmt.Errorf("failed to download original image: %w", err)
+	}
+	mask, err := pu.imageStorageService.DownloadImage(result.MaskKey)
+	if err != nil {
+		return domain.ProcessedImage{}, fmt.Errorf("failed to download mask image: %w", err)
+	}
+
+	data, format, err := compositeImage(original, mask, opts)
+	if err != nil {
+		return domain.ProcessedImage{}, err
+	}
+
+	// 差し替え前の画像がキャッシュから表示されないよう、作り直すたびに別のキーに保存する
+	renderId := fmt.Sprintf("%s-%d", opts.Effect, time.Now().UnixNano())
+	processedName := fmt.Sprintf("processed/%s/%s.%s", sessionId, renderId, format)
+	processed, err := pu.storeProcessedImage(data, format, processedName, fmt.Sprintf("renditions/%s/%s", sessionId, renderId))
+	if err != nil {
+		return domain.ProcessedImage{}, err
+	}
+	processed.OriginalKey = result.OriginalKey
+	processed.MaskKey = result.MaskKey
+
+	if err := pu.sessionStoreService.SaveProcessedImage(sessionId, processed); err != nil {
+		return domain.ProcessedImage{}, err
+	}
+	return processed, nil
+}
+
+// storeProcessedImage は加工済み画像とサイズ別の画像を保存し、署名付きURLを返す。
+// サイズ別の画像は renditionPrefix の下に保存する
+func (pu *ProcessUsecase) storeProcessedImage(data []byte, format imaging.Format, name string, renditionPrefix string) (domain.ProcessedImage, error) {
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := pu.imageStorageService.UploadImage(bytes.NewReader(data), name, format.ContentType()); err != nil {
+			errs[0] = fmt.Errorf("failed to upload processed image: %w", err)
+		}
+	}()
+
+	var renditions map[string]string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var err error
+		if renditions, err = pu.storeRenditions(renditionPrefix, data); err != nil {
+			errs[1] = fmt.Errorf("failed to store renditions: %w", err)
+		}
+	}()
+
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return domain.ProcessedImage{}, err
+	}
+
+	url, err := pu.imageStorageService.GeneratePresignedGetURL(name, format.ContentType())
+	if err != nil {
+		return domain.ProcessedImage{}, err
+	}
+	return domain.ProcessedImage{URL: url, Renditions: renditions}, nil
+}
+
+// compositeImage は元の画像とマスクを合成し、元の画像と同じ形式でエンコードする
+func compositeImage(originalImage []byte, mask []byte, opts compositing.Options) ([]byte, imaging.Format, error) {
+	original, format, err := imaging.Decode(originalImage)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode original image: %w", err)
+	}
+	maskImage, _, err := imaging.Decode(mask)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode mask image: %w", err)
+	}
+	composited, err := compositing.Composite(original, maskImage, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return imaging.Encode(composited, format)
+}
+
+// storeRenditions は加工済み画像からサイズ別の画像を作って prefix の下に保存し、サイズ名ごとの署名付きURLを返す
+func (pu *ProcessUsecase) storeRenditions(prefix string, processedImage []byte) (map[string]string, error) {
+	img, _, err := imaging.Decode(processedImage)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	urls := make(map[string]string, len(imaging.Renditions))
+	errs := make([]error, len(imaging.Renditions))
+	for i, rendition := range imaging.Renditions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 余白を透明にするため PNG で保存する
+			data, format, err := imaging.Encode(rendition.Render(img), imaging.FormatPNG)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			name := fmt.Sprintf("%s/%s.png", prefix, rendition.Name)
+			if err := pu.imageStorageService.UploadImage(bytes.NewReader(data), name, format.ContentType()); err != nil {
+				errs[i] = fmt.Errorf("failed to upload %s: %w", rendition.Name, err)
+				return
+			}
+			url, err := pu.imageStorageService.GeneratePresignedGetURL(name, format.ContentType())
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			mu.Lock()
+			urls[rendition.Name] = url
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return urls, nil
 }
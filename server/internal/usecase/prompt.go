@@ -0,0 +1,110 @@
+package usecase
+
+import (
+	"climbinsight/server/internal/domain"
+	"errors"
+	"fmt"
+)
+
+// PointLabel はリクエストで指定する座標の種類。空なら抽出したいホールド（positive）として扱う
+type PointLabel string
+
+const (
+	PointLabelPositive PointLabel = "positive"
+	PointLabelNegative PointLabel = "negative"
+)
+
+type Point struct {
+	X     float64    `json:"x"`
+	Y     float64    `json:"y"`
+	Label PointLabel `json:"label,omitempty"`
+}
+
+// Box は抽出する範囲を囲む矩形。(X1, Y1) が左上、(X2, Y2) が右下
+type Box struct {
+	X1 float64 `json:"x1"`
+	Y1 float64 `json:"y1"`
+	X2 float64 `json:"x2"`
+	Y2 float64 `json:"y2"`
+}
+
+// maxPoints は1回の抽出で指定できる座標の数の上限。AIサービスは positive の座標ごとに推論する
+const maxPoints = 30
+
+// Prompt はAIサービスに渡す抽出範囲の指定。
+// negative の座標は隣のホールドなど、抽出したくない部分を指す
+type Prompt struct {
+	Points []Point
+	// Box は省略できる
+	Box *Box
+	// Normalized が true なら座標と矩形を画像の幅・高さに対する 0〜1 の割合で表す。
+	// false ならピクセル単位（向きを揃えた後の画像の座標）
+	Normalized bool
+}
+
+// Validate は座標の数と、座標・矩形が width x height の画像の内側にあることを検証する
+func (p Prompt) Validate(width, height int) error {
+	if len(p.Points) > maxPoints {
+		return fmt.Errorf("at most %d points are allowed", maxPoints)
+	}
+	maxX, maxY := float64(width), float64(height)
+	if p.Normalized {
+		maxX, maxY = 1, 1
+	}
+	inside := func(x, y float64) bool {
+		return x >= 0 && x <= maxX && y >= 0 && y <= maxY
+	}
+
+	positive := 0
+	for _, point := range p.Points {
+		switch point.Label {
+		case "", PointLabelPositive:
+			positive++
+		case PointLabelNegative:
+		default:
+			return fmt.Errorf("unknown point label: %q", point.Label)
+		}
+		if !inside(point.X, point.Y) {
+			return fmt.Errorf("point (%g, %g) is outside the image", point.X, point.Y)
+		}
+	}
+	// 除外する座標だけでは抽出する部分が決まらない
+	if positive == 0 && p.Box == nil {
+		return errors.New("at least one positive point or a box is required")
+	}
+	if p.Box != nil {
+		if p.Box.X2 <= p.Box.X1 || p.Box.Y2 <= p.Box.Y1 {
+			return errors.New("box must have x1 < x2 and y1 < y2")
+		}
+		if !inside(p.Box.X1, p.Box.Y1) || !inside(p.Box.X2, p.Box.Y2) {
+			return errors.New("box is outside the image")
+		}
+	}
+	return nil
+}
+
+// toDomain は width x height の画像のピクセル単位の座標に変換する
+func (p Prompt) toDomain(width, height int) ([]domain.Point, *domain.Box) {
+	scaleX, scaleY := 1.0, 1.0
+	if p.Normalized {
+		scaleX, scaleY = float64(width), float64(height)
+	}
+
+	points := make([]domain.Point, 0, len(p.Points))
+	for _, point := range p.Points {
+		label := domain.PointLabelPositive
+		if point.Label == PointLabelNegative {
+			label = domain.PointLabelNegative
+		}
+		points = append(points, domain.Point{X: point.X * scaleX, Y: point.Y * scaleY, Label: label})
+	}
+	if p.Box == nil {
+		return points, nil
+	}
+	return points, &domain.Box{
+		X1: p.Box.X1 * scaleX,
+		Y1: p.Box.Y1 * scaleY,
+		X2: p.Box.X2 * scaleX,
+		Y2: p.Box.Y2 * scaleY,
+	}
+}
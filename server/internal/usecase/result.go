@@ -1,6 +1,9 @@
 package usecase
 
-import "climbinsight/server/internal/domain"
+import (
+	"climbinsight/server/internal/domain"
+	"context"
+)
 
 type ResultUsecase struct {
 	sessionStoreService domain.ISessionStoreService
@@ -17,3 +20,11 @@ func (ru *ResultUsecase) GetResult(sessionId string) (*domain.Result, error) {
 	}
 	return result, nil
 }
+
+func (ru *ResultUsecase) GetEvents(sessionId string, afterId int64) ([]domain.Event, error) {
+	return ru.sessionStoreService.GetEvents(sessionId, afterId)
+}
+
+func (ru *ResultUsecase) Subscribe(ctx context.Context, sessionId string) (<-chan struct{}, error) {
+	return ru.sessionStoreService.Subscribe(ctx, sessionId)
+}
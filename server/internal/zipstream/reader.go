@@ -0,0 +1,364 @@
+// zipstream は zip を先頭から順に読み、展開後の大きさを制限しながら取り出す。
+// archive/zip と違い全体をメモリやファイルに置く必要がないため、HTTP のレスポンスをそのまま読める
+package zipstream
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	localHeaderSignature     = 0x04034b50
+	centralHeaderSignature   = 0x02014b50
+	endOfCentralDirSignature = 0x06054b50
+	dataDescriptorSignature  = 0x08074b50
+	localHeaderLen           = 30
+	flagEncrypted            = 0x1
+	flagDataDescriptor       = 0x8
+	zip64ExtraID             = 0x0001
+	methodStore              = 0
+	methodDeflate            = 8
+)
+
+// sizeUnknown はローカルヘッダーにサイズがないことを表す
+const sizeUnknown int64 = -1
+
+var (
+	// ErrTooLarge は展開後の大きさかエントリ数が上限を超えたことを表す
+	ErrTooLarge = errors.New("zip entry exceeds size limit")
+	// ErrInvalidName はディレクトリを含むなど、受け付けないエントリ名であることを表す
+	ErrInvalidName = errors.New("invalid zip entry name")
+	// ErrFormat は zip として読めないことを表す
+	ErrFormat = errors.New("invalid zip format")
+)
+
+// Limits は展開を受け付ける上限。0 なら制限しない
+type Limits struct {
+	// MaxEntryBytes は1つのエントリの展開後の大きさの上限
+	MaxEntryBytes int64
+	// MaxTotalBytes は全エントリの展開後の大きさの合計の上限
+	MaxTotalBytes int64
+	// MaxEntries はエントリ数の上限
+	MaxEntries int
+}
+
+// Reader は zip のエントリを先頭から順に読む。
+// 中央ディレクトリは読まないため、ローカルヘッダーにサイズがなく無圧縮のエントリには対応しない
+type Reader struct {
+	r      *countingReader
+	limits Limits
+	total  int64
+	names  map[string]bool
+	entry  *entryReader
+	err    error
+}
+
+func NewReader(r io.Reader, limits Limits) *Reader {
+	return &Reader{
+		r:      &countingReader{r: bufio.NewReader(r)},
+		limits: limits,
+		names:  make(map[string]bool),
+	}
+}
+
+// Next は次のエントリに進み、その名前を返す。読み終わっていない前のエントリは読み捨てる。
+// エントリがもうなければ io.EOF を返す
+func (zr *Reader) Next() (string, error) {
+	if zr.err != nil {
+		return "", zr.err
+	}
+	name, err := zr.next()
+	if err != nil {
+		zr.err = err
+		return "", err
+	}
+	return name, nil
+}
+
+func (zr *Reader) next() (string, error) {
+	if zr.entry != nil {
+		// CRC とデータディスクリプタを確認するため最後まで読む
+		if _, err := io.Copy(io.Discard, zr.entry); err != nil {
+			return "", err
+		}
+		zr.entry = nil
+	}
+
+	var sig uint32
+	if err := binary.Read(zr.r, binary.LittleEndian, &sig); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrFormat, noEOF(err))
+	}
+	switch sig {
+	case localHeaderSignature:
+	case centralHeaderSignature, endOfCentralDirSignature:
+		return "", io.EOF
+	default:
+		return "", fmt.Errorf("%w: unexpected signature %#x", ErrFormat, sig)
+	}
+
+	if zr.limits.MaxEntries > 0 && len(zr.names) >= zr.limits.MaxEntries {
+		return "", fmt.Errorf("%w: more than %d entries", ErrTooLarge, zr.limits.MaxEntries)
+	}
+
+	hdr, err := zr.readLocalHeader()
+	if err != nil {
+		return "", err
+	}
+	if err := validName(hdr.name); err != nil {
+		return "", err
+	}
+	if zr.names[hdr.name] {
+		return "", fmt.Errorf("%w: duplicate entry %q", ErrInvalidName, hdr.name)
+	}
+	zr.names[hdr.name] = true
+
+	limit := zr.remaining()
+	if hdr.size != sizeUnknown && limit >= 0 && hdr.size > limit {
+		return "", fmt.Errorf("%w: %s is %d bytes", ErrTooLarge, hdr.name, hdr.size)
+	}
+
+	entry := &entryReader{zr: zr, hdr: hdr, start: zr.r.n, crc: crc32.NewIEEE(), limit: limit}
+	switch hdr.method {
+	case methodStore:
+		if hdr.compressedSize == sizeUnknown {
+			return "", fmt.Errorf("%w: stored entry %s has no size", ErrFormat, hdr.name)
+		}
+		entry.src = io.LimitReader(zr.r, hdr.compressedSize)
+	case methodDeflate:
+		// countingReader は io.ByteReader なので、flate はエントリの終わりを越えて読まない
+		fr := flate.NewReader(zr.r)
+		entry.src, entry.closer = fr, fr
+	default:
+		return "", fmt.Errorf("%w: unsupported compression method %d", ErrFormat, hdr.method)
+	}
+	zr.entry = entry
+	return hdr.name, nil
+}
+
+// Read は現在のエントリの展開後のデータを読む
+func (zr *Reader) Read(p []byte) (int, error) {
+	if zr.err != nil {
+		return 0, zr.err
+	}
+	if zr.entry == nil {
+		return 0, io.EOF
+	}
+	n, err := zr.entry.Read(p)
+	if err != nil && err != io.EOF {
+		zr.err = err
+	}
+	return n, err
+}
+
+// remaining は次に読むエントリが展開してよい大きさ。-1 なら制限しない
+func (zr *Reader) remaining() int64 {
+	limit := int64(-1)
+	if zr.limits.MaxEntryBytes > 0 {
+		limit = zr.limits.MaxEntryBytes
+	}
+	if zr.limits.MaxTotalBytes > 0 {
+		if left := zr.limits.MaxTotalBytes - zr.total; limit < 0 || left < limit {
+			limit = left
+		}
+	}
+	return limit
+}
+
+type localHeader struct {
+	name           string
+	flags          uint16
+	method         uint16
+	crc32          uint32
+	compressedSize int64
+	size           int64
+	zip64          bool
+}
+
+func (zr *Reader) readLocalHeader() (localHeader, error) {
+	var buf [localHeaderLen - 4]byte
+	if _, err := io.ReadFull(zr.r, buf[:]); err != nil {
+		return localHeader{}, fmt.Errorf("%w: %v", ErrFormat, noEOF(err))
+	}
+	hdr := localHeader{
+		flags:          binary.LittleEndian.Uint16(buf[2:]),
+		method:         binary.LittleEndian.Uint16(buf[4:]),
+		crc32:          binary.LittleEndian.Uint32(buf[10:]),
+		compressedSize: int64(binary.LittleEndian.Uint32(buf[14:])),
+		size:           int64(binary.LittleEndian.Uint32(buf[18:])),
+	}
+	nameLen := int(binary.LittleEndian.Uint16(buf[22:]))
+	extraLen := int(binary.LittleEndian.Uint16(buf[24:]))
+
+	nameAndExtra := make([]byte, nameLen+extraLen)
+	if _, err := io.ReadFull(zr.r, nameAndExtra); err != nil {
+		return localHeader{}, fmt.Errorf("%w: %v", ErrFormat, noEOF(err))
+	}
+	hdr.name = string(nameAndExtra[:nameLen])
+
+	if hdr.flags&flagEncrypted != 0 {
+		return localHeader{}, fmt.Errorf("%w: encrypted entry %s", ErrFormat, hdr.name)
+	}
+	hdr.zip64 = hasZip64Extra(nameAndExtra[nameLen:])
+	// サイズがデータディスクリプタや zip64 の拡張フィールドにある場合は、読み終わるまで分からない
+	if hdr.flags&flagDataDescriptor != 0 || hdr.zip64 {
+		hdr.compressedSize, hdr.size = sizeUnknown, sizeUnknown
+	}
+	return hdr, nil
+}
+
+func hasZip64Extra(extra []byte) bool {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if id == zip64ExtraID {
+			return true
+		}
+		if len(extra) < 4+size {
+			break
+		}
+		extra = extra[4+size:]
+	}
+	return false
+}
+
+// validName はディレクトリを含まない通常のファイル名だけを受け付ける
+func validName(name string) error {
+	switch {
+	case name == "", name == ".", name == "..",
+		strings.ContainsAny(name, "/\\\x00"),
+		!utf8.ValidString(name):
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+type entryReader struct {
+	zr     *Reader
+	hdr    localHeader
+	src    io.Reader
+	closer io.Closer
+	crc    hash.Hash32
+	// start は圧縮データの開始位置、n は展開したバイト数
+	start int64
+	n     int64
+	limit int64
+	err   error
+}
+
+func (er *entryReader) Read(p []byte) (int, error) {
+	if er.err != nil {
+		return 0, er.err
+	}
+	// 上限を1バイト超えて読めたら超過とみなす
+	if er.limit >= 0 && int64(len(p)) > er.limit-er.n+1 {
+		p = p[:er.limit-er.n+1]
+	}
+	n, err := er.src.Read(p)
+	er.n += int64(n)
+	er.zr.total += int64(n)
+	if er.limit >= 0 && er.n > er.limit {
+		er.err = fmt.Errorf("%w: %s", ErrTooLarge, er.hdr.name)
+		return 0, er.err
+	}
+	er.crc.Write(p[:n])
+
+	switch {
+	case err == io.EOF:
+		if err := er.finish(); err != nil {
+			er.err = err
+			return n, err
+		}
+		er.err = io.EOF
+	case err == io.ErrUnexpectedEOF:
+		er.err = fmt.Errorf("%w: %s is truncated", ErrFormat, er.hdr.name)
+		return n, er.err
+	case err != nil:
+		er.err = err
+	}
+	return n, err
+}
+
+// finish はエントリを読み終えた後に、データディスクリプタを読んで CRC とサイズを確かめる
+func (er *entryReader) finish() error {
+	if er.closer != nil {
+		er.closer.Close()
+	}
+	compressed := er.zr.r.n - er.start
+	hdr := er.hdr
+
+	if hdr.flags&flagDataDescriptor != 0 {
+		var err error
+		if hdr.crc32, hdr.compressedSize, hdr.size, err = er.readDataDescriptor(); err != nil {
+			return err
+		}
+	}
+	if hdr.size != sizeUnknown && (hdr.size != er.n || hdr.compressedSize != compressed) {
+		return fmt.Errorf("%w: size mismatch in %s", ErrFormat, hdr.name)
+	}
+	if hdr.crc32 != er.crc.Sum32() {
+		return fmt.Errorf("%w: checksum mismatch in %s", ErrFormat, hdr.name)
+	}
+	return nil
+}
+
+// readDataDescriptor はシグネチャが省略されたデータディスクリプタも読む
+func (er *entryReader) readDataDescriptor() (crc uint32, compressedSize, size int64, err error) {
+	r := er.zr.r
+	var first uint32
+	if err := binary.Read(r, binary.LittleEndian, &first); err != nil {
+		return 0, 0, 0, fmt.Errorf("%w: %v", ErrFormat, noEOF(err))
+	}
+	crc = first
+	if first == dataDescriptorSignature {
+		if err := binary.Read(r, binary.LittleEndian, &crc); err != nil {
+			return 0, 0, 0, fmt.Errorf("%w: %v", ErrFormat, noEOF(err))
+		}
+	}
+	if er.hdr.zip64 {
+		var sizes [2]uint64
+		if err := binary.Read(r, binary.LittleEndian, &sizes); err != nil {
+			return 0, 0, 0, fmt.Errorf("%w: %v", ErrFormat, noEOF(err))
+		}
+		return crc, int64(sizes[0]), int64(sizes[1]), nil
+	}
+	var sizes [2]uint32
+	if err := binary.Read(r, binary.LittleEndian, &sizes); err != nil {
+		return 0, 0, 0, fmt.Errorf("%w: %v", ErrFormat, noEOF(err))
+	}
+	return crc, int64(sizes[0]), int64(sizes[1]), nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingReader は読んだバイト数を数える
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
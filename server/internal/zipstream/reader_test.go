@@ -0,0 +1,318 @@
+package zipstream
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	name    string
+	data    []byte
+	deflate bool
+	// descriptor は CRC とサイズをローカルヘッダーではなくデータディスクリプタに書く
+	descriptor bool
+	// noDescriptorSignature はデータディスクリプタのシグネチャを省く
+	noDescriptorSignature bool
+	// badCRC と badSize は記録する CRC と展開後のサイズを実際と変える
+	badCRC  bool
+	badSize bool
+}
+
+// buildZip はローカルヘッダーとデータ、終端レコードだけの zip を作る
+func buildZip(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	write := func(v any) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, e := range entries {
+		payload, method := e.data, uint16(methodStore)
+		if e.deflate {
+			var compressed bytes.Buffer
+			fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(e.data)
+			fw.Close()
+			payload, method = compressed.Bytes(), methodDeflate
+		}
+
+		crc, size := crc32.ChecksumIEEE(e.data), uint32(len(e.data))
+		if e.badCRC {
+			crc++
+		}
+		if e.badSize {
+			size++
+		}
+		var flags uint16
+		hdrCRC, hdrCompressed, hdrSize := crc, uint32(len(payload)), size
+		if e.descriptor {
+			flags |= flagDataDescriptor
+			hdrCRC, hdrCompressed, hdrSize = 0, 0, 0
+		}
+
+		write(uint32(localHeaderSignature))
+		write([]uint16{20, flags, method, 0, 0})
+		write([]uint32{hdrCRC, hdrCompressed, hdrSize})
+		write([]uint16{uint16(len(e.name)), 0})
+		buf.WriteString(e.name)
+		buf.Write(payload)
+		if e.descriptor {
+			if !e.noDescriptorSignature {
+				write(uint32(dataDescriptorSignature))
+			}
+			write([]uint32{crc, uint32(len(payload)), size})
+		}
+	}
+	write(uint32(endOfCentralDirSignature))
+	buf.Write(make([]byte, 18))
+	return buf.Bytes()
+}
+
+// readEntries はすべてのエントリを読む。skip なら中身を読まずに Next で読み捨てる
+func readEntries(data []byte, limits Limits, skip bool) (map[string]string, error) {
+	zr := NewReader(bytes.NewReader(data), limits)
+	entries := make(map[string]string)
+	for {
+		name, err := zr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		if skip {
+			entries[name] = ""
+			continue
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			return entries, err
+		}
+		entries[name] = string(b)
+	}
+}
+
+func TestReader(t *testing.T) {
+	image := []byte(strings.Repeat("climbinsight", 100))
+	mask := []byte(strings.Repeat("\x00\xff", 300))
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+		limits  Limits
+		skip    bool
+		want    map[string]string
+		wantErr error
+	}{
+		{
+			name:    "stored",
+			entries: []testEntry{{name: "image.png", data: image}},
+			want:    map[string]string{"image.png": string(image)},
+		},
+		{
+			name:    "deflate",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true}},
+			want:    map[string]string{"image.png": string(image)},
+		},
+		{
+			name:    "deflate with data descriptor",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, descriptor: true}},
+			want:    map[string]string{"image.png": string(image)},
+		},
+		{
+			name:    "deflate with data descriptor without signature",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, descriptor: true, noDescriptorSignature: true}},
+			want:    map[string]string{"image.png": string(image)},
+		},
+		{
+			name: "multiple entries",
+			entries: []testEntry{
+				{name: "image.png", data: image},
+				{name: "mask.png", data: mask, deflate: true, descriptor: true},
+				{name: "empty", data: nil},
+			},
+			want: map[string]string{"image.png": string(image), "mask.png": string(mask), "empty": ""},
+		},
+		{
+			name:    "stored with data descriptor",
+			entries: []testEntry{{name: "image.png", data: image, descriptor: true}},
+			wantErr: ErrFormat,
+		},
+		{
+			name:    "stored checksum mismatch",
+			entries: []testEntry{{name: "image.png", data: image, badCRC: true}},
+			wantErr: ErrFormat,
+		},
+		{
+			name:    "deflate checksum mismatch in data descriptor",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, descriptor: true, badCRC: true}},
+			wantErr: ErrFormat,
+		},
+		{
+			name:    "stored size mismatch",
+			entries: []testEntry{{name: "image.png", data: image, badSize: true}},
+			wantErr: ErrFormat,
+		},
+		{
+			name:    "deflate size mismatch",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, badSize: true}},
+			wantErr: ErrFormat,
+		},
+		{
+			name:    "deflate size mismatch in data descriptor",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, descriptor: true, badSize: true}},
+			wantErr: ErrFormat,
+		},
+		{
+			name:    "checksum mismatch in skipped entry",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, badCRC: true}, {name: "mask.png", data: mask}},
+			skip:    true,
+			wantErr: ErrFormat,
+		},
+		{
+			name:    "entry within limits",
+			entries: []testEntry{{name: "image.png", data: image}, {name: "mask.png", data: mask, deflate: true, descriptor: true}},
+			limits:  Limits{MaxEntryBytes: int64(len(image)), MaxTotalBytes: int64(len(image) + len(mask)), MaxEntries: 2},
+			want:    map[string]string{"image.png": string(image), "mask.png": string(mask)},
+		},
+		{
+			name:    "entry too large by header",
+			entries: []testEntry{{name: "image.png", data: image}},
+			limits:  Limits{MaxEntryBytes: int64(len(image)) - 1},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "entry too large while inflating",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, descriptor: true}},
+			limits:  Limits{MaxEntryBytes: int64(len(image)) - 1},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "skipped entry too large",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, descriptor: true}},
+			limits:  Limits{MaxEntryBytes: int64(len(image)) - 1},
+			skip:    true,
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "total too large",
+			entries: []testEntry{{name: "image.png", data: image}, {name: "mask.png", data: mask}},
+			limits:  Limits{MaxTotalBytes: int64(len(image)+len(mask)) - 1},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "total too large by skipped entries",
+			entries: []testEntry{{name: "image.png", data: image, deflate: true, descriptor: true}, {name: "mask.png", data: mask, deflate: true, descriptor: true}},
+			limits:  Limits{MaxTotalBytes: int64(len(image)+len(mask)) - 1},
+			skip:    true,
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "too many entries",
+			entries: []testEntry{{name: "a", data: mask}, {name: "b", data: mask}, {name: "c", data: mask}},
+			limits:  Limits{MaxEntries: 2},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "too many skipped entries",
+			entries: []testEntry{{name: "a", data: mask}, {name: "b", data: mask}, {name: "c", data: mask}},
+			limits:  Limits{MaxEntries: 2},
+			skip:    true,
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "parent directory",
+			entries: []testEntry{{name: "../x", data: mask}},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name:    "directory",
+			entries: []testEntry{{name: "a/b", data: mask}},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name:    "backslash",
+			entries: []testEntry{{name: `a\b`, data: mask}},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name:    "NUL",
+			entries: []testEntry{{name: "a\x00.png", data: mask}},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name:    "empty name",
+			entries: []testEntry{{name: "", data: mask}},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name:    "invalid UTF-8",
+			entries: []testEntry{{name: "\xff.png", data: mask}},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name:    "duplicate",
+			entries: []testEntry{{name: "mask.png", data: mask}, {name: "mask.png", data: image}},
+			wantErr: ErrInvalidName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readEntries(buildZip(t, tt.entries...), tt.limits, tt.skip)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	data := buildZip(t,
+		testEntry{name: "image.png", data: []byte(strings.Repeat("climbinsight", 100))},
+		testEntry{name: "mask.png", data: []byte(strings.Repeat("\x00\xff", 300)), deflate: true, descriptor: true},
+	)
+	// 終端レコードのシグネチャまでを読めなければ、どこで切れても ErrFormat になる
+	end := len(data) - 18
+	for n := range end {
+		for _, skip := range []bool{false, true} {
+			if _, err := readEntries(data[:n], Limits{}, skip); !errors.Is(err, ErrFormat) {
+				t.Errorf("truncated at %d (skip=%v): err = %v, want %v", n, skip, err, ErrFormat)
+			}
+		}
+	}
+}
+
+func TestReaderErrorIsSticky(t *testing.T) {
+	data := buildZip(t, testEntry{name: "../x", data: []byte("x")})
+	zr := NewReader(bytes.NewReader(data), Limits{})
+	if _, err := zr.Next(); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidName)
+	}
+	if _, err := zr.Next(); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("second Next: err = %v, want %v", err, ErrInvalidName)
+	}
+	if _, err := zr.Read(make([]byte, 1)); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Read: err = %v, want %v", err, ErrInvalidName)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"net/http"
 	"os"
 	"time"
 
@@ -9,6 +10,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"climbinsight/server/internal/domain"
+	"climbinsight/server/internal/imaging"
 	"climbinsight/server/internal/infra"
 	"climbinsight/server/internal/presentation"
 	"climbinsight/server/internal/usecase"
@@ -24,17 +27,39 @@ func init() {
 
 func main() {
 	// サービス群作成
-	ies := infra.NewImageEditService()
-	tgs := infra.NewTextGenerateService()
-	sh, _ := infra.NewimageStorageService()
-	ts, _ := infra.NewSessionStoreService()
+	sh, localStorage := newImageStorageService()
+	ts := newSessionStoreService()
+	// AIサービスには縮小した画像を送る
+	var ies domain.IImageEditService
+	ies, err := infra.NewDownscaleImageEditService(newImageEditService())
+	if err != nil {
+		log.Fatalf("❌ 画像抽出サービスの作成に失敗: %v", err)
+	}
+	// 同じ画像と座標の抽出はキャッシュから返す
+	cacheIndex := newExtractionCacheIndex()
+	var ecu *usecase.ExtractionCacheUsecase
+	if cacheIndex != nil {
+		ies = infra.NewCachedImageEditService(ies, sh, cacheIndex)
+		ecu = usecase.NewExtractionCacheUsecase(cacheIndex, sh)
+		// 期限が切れた結果は画像ストレージからも消す
+		go ecu.SweepExpired()
+	}
+	tgs, err := infra.NewTextGenerateService()
+	if err != nil {
+		log.Fatalf("❌ 投稿文生成サービスの作成に失敗: %v", err)
+	}
 
 	// ユースケース群作成
 	gu := usecase.NewGenerateUsecase(tgs, ts)
 	pu := usecase.NewProcessUsecase(ies, sh, ts)
 	ru := usecase.NewResultUsecase(ts)
 
-	h := presentation.NewHandler(gu, pu, ru)
+	limits, err := imaging.LimitsFromEnv()
+	if err != nil {
+		log.Fatalf("❌ アップロード制限の読み込みに失敗: %v", err)
+	}
+
+	h := presentation.NewHandler(gu, pu, ru, limits)
 
 	r := gin.Default()
 
@@ -53,14 +78,98 @@ func main() {
 		})
 	})
 
+	// ローカルストレージの場合は署名付きURLで画像を配信する
+	if localStorage != nil {
+		r.GET("/storage/*key", gin.WrapH(http.StripPrefix("/storage", localStorage)))
+	}
+
 	r.GET("/result", h.GetResult)
 	r.POST("/inquery", h.SendInquery)
 
 	images := r.Group("/images")
 	images.POST("/process", h.Process)
+	images.POST("/:session/render", h.Render)
 
 	contents := r.Group("/contents")
 	contents.POST("/generate", h.Generate)
+	contents.POST("/regenerate", h.Regenerate)
+
+	// 運用者向けの API は ADMIN_TOKEN を設定した場合だけ有効にする
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" && ecu != nil {
+		ah := presentation.NewAdminHandler(ecu)
+		admin := r.Group("/admin", presentation.RequireAdminToken(adminToken))
+		admin.GET("/extraction-cache", ah.GetExtractionCacheStats)
+		admin.DELETE("/extraction-cache", ah.PurgeExtractionCache)
+	}
 
 	r.Run(":8080")
 }
+
+// newImageStorageService は STORAGE_BACKEND に応じて画像ストレージを作成する。
+// local の場合は画像を配信するハンドラも返す
+func newImageStorageService() (domain.IImageStorageService, http.Handler) {
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "local":
+		ls, err := infra.NewLocalImageStorageService()
+		if err != nil {
+			log.Fatalf("❌ ローカルストレージの作成に失敗: %v", err)
+		}
+		return ls, ls
+	default:
+		sh, _ := infra.NewimageStorageService()
+		return sh, nil
+	}
+}
+
+// newImageEditService は AI_TRANSPORT に応じてAIサービスのクライアントを作成する。
+// grpc なら gRPC、それ以外は HTTP で zip を送る
+func newImageEditService() domain.IImageEditService {
+	var ies domain.IImageEditService
+	var err error
+	switch os.Getenv("AI_TRANSPORT") {
+	case "grpc":
+		ies, err = infra.NewGRPCImageEditService()
+	default:
+		ies, err = infra.NewImageEditService()
+	}
+	if err != nil {
+		log.Fatalf("❌ 画像抽出サービスの作成に失敗: %v", err)
+	}
+	return ies
+}
+
+// newExtractionCacheIndex は EXTRACTION_CACHE_BACKEND に応じて抽出結果のキャッシュの索引を作成する。
+// 未設定ならキャッシュしないので nil を返す
+func newExtractionCacheIndex() domain.IExtractionCacheIndex {
+	var index domain.IExtractionCacheIndex
+	var err error
+	switch backend := os.Getenv("EXTRACTION_CACHE_BACKEND"); backend {
+	case "":
+		return nil
+	case "redis":
+		index, err = infra.NewRedisExtractionCacheIndex()
+	case "memory":
+		index, err = infra.NewMemoryExtractionCacheIndex()
+	default:
+		log.Fatalf("❌ EXTRACTION_CACHE_BACKEND が不正です: %q", backend)
+	}
+	if err != nil {
+		log.Fatalf("❌ 抽出結果のキャッシュの作成に失敗: %v", err)
+	}
+	return index
+}
+
+// newSessionStoreService は SESSION_BACKEND に応じてセッションストアを作成する。
+// memory の場合はプロセス内に保持するため、複数ノードでは使えない
+func newSessionStoreService() domain.ISessionStoreService {
+	switch os.Getenv("SESSION_BACKEND") {
+	case "memory":
+		return infra.NewMemorySessionStoreService()
+	default:
+		ts, err := infra.NewSessionStoreService()
+		if err != nil {
+			log.Fatalf("❌ セッションストアの作成に失敗: %v", err)
+		}
+		return ts
+	}
+}
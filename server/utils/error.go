@@ -43,3 +43,19 @@ func RespondError(c *gin.Context, status int, message string, err error) {
 		Error: message,
 	})
 }
+
+// ReportError はレスポンス返却後のバックグラウンド処理で発生したエラーをログに記録し、Slackに通知する
+func ReportError(message string, sessionId string, err error) {
+	slog.Error(message,
+		slog.String("session", sessionId),
+		slog.Any("error", err),
+	)
+
+	noticeMessage := fmt.Sprintf(`
+		session: %s
+		err: %s
+		content: %s
+	`, sessionId, err.Error(), message)
+
+	NoticeToSlack("エラー", noticeMessage)
+}